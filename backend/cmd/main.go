@@ -9,6 +9,8 @@ import (
 	"github.com/VinukaThejana/auth/backend/controllers"
 	"github.com/VinukaThejana/auth/backend/initialize"
 	"github.com/VinukaThejana/auth/backend/middleware"
+	"github.com/VinukaThejana/auth/backend/templates"
+	"github.com/VinukaThejana/auth/backend/utils"
 	"github.com/VinukaThejana/go-utils/logger"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -22,10 +24,16 @@ var (
 	env config.Env
 	h   initialize.H
 
-	auth  controllers.Auth
-	user  controllers.User
-	email controllers.Email
-	oauth controllers.OAuth
+	auth          controllers.Auth
+	user          controllers.User
+	email         controllers.Email
+	oauth         controllers.OAuth
+	authorization controllers.Authorization
+	client        controllers.Client
+	internal      controllers.Internal
+	device        controllers.Device
+	saml          controllers.SAML
+	outbox        controllers.Outbox
 )
 
 func init() {
@@ -34,9 +42,19 @@ func init() {
 	h.InitDB(&env)
 	h.InitiRedis(&env)
 	h.InitStorage(&env)
+	h.InitMailer(&env)
+
+	if env.EmailTemplatesDir != "" {
+		err := templates.Email{}.Load(env.EmailTemplatesDir)
+		if err != nil {
+			log.Errorf(err, nil)
+		}
+	}
 }
 
 func main() {
+	go utils.Outbox{}.Work(&h)
+
 	app := fiber.New()
 
 	app.Use(fiberLogger.New())
@@ -67,6 +85,19 @@ func main() {
 		return c.Redirect("https://app.theneo.io/szeeta/auth")
 	})
 
+	app.Get("/.well-known/openid-configuration", func(c *fiber.Ctx) error {
+		return authorization.OpenIDConfiguration(c, &env)
+	})
+	app.Get("/.well-known/jwks.json", func(c *fiber.Ctx) error {
+		return authorization.JWKS(c, &env)
+	})
+	app.Get("/userinfo", func(c *fiber.Ctx) error {
+		return authorization.UserInfo(c, &h, &env)
+	})
+	app.Post("/userinfo", func(c *fiber.Ctx) error {
+		return authorization.UserInfo(c, &h, &env)
+	})
+
 	authG := app.Group("/auth")
 	authG.Post("/register", func(c *fiber.Ctx) error {
 		return auth.Register(c, &h, &env)
@@ -83,17 +114,102 @@ func main() {
 	authG.Post("/logout", func(c *fiber.Ctx) error {
 		return auth.Logout(c, &h, &env)
 	})
+	authG.Post("/password/forgot", func(c *fiber.Ctx) error {
+		return auth.ForgotPassword(c, &h, &env)
+	})
+	authG.Post("/password/reset", func(c *fiber.Ctx) error {
+		return auth.ResetPassword(c, &h, &env)
+	})
+	authG.Post("/magic-link", func(c *fiber.Ctx) error {
+		return auth.MagicLink(c, &h, &env)
+	})
+	authG.Get("/magic-link/verify", func(c *fiber.Ctx) error {
+		return auth.VerifyMagicLink(c, &h, &env)
+	})
+	authG.Post("/otp/request", func(c *fiber.Ctx) error {
+		return auth.RequestOTP(c, &h, &env)
+	})
+	authG.Post("/otp/verify", func(c *fiber.Ctx) error {
+		return auth.VerifyOTP(c, &h, &env)
+	})
 
 	oauthG := app.Group("/oauth")
 	oauthG.Route("/redirects", func(router fiber.Router) {
 		router.Get("/github", func(c *fiber.Ctx) error {
-			return oauth.RedirectToGitHubOAuthFlow(c, &env)
+			return oauth.RedirectToGitHubOAuthFlow(c, &h, &env)
+		})
+		router.Get("/apple", func(c *fiber.Ctx) error {
+			return oauth.RedirectToAppleOAuthFlow(c, &h, &env)
+		})
+		router.Get("/oidc/:provider", func(c *fiber.Ctx) error {
+			return oauth.RedirectToOIDCFlow(c, &h, &env)
+		})
+		router.Get("/saml/:connection", func(c *fiber.Ctx) error {
+			return saml.RedirectToSAMLFlow(c, &h, &env)
 		})
 	})
 	oauthG.Route("/sessions", func(router fiber.Router) {
 		router.Get("/github", func(c *fiber.Ctx) error {
 			return oauth.GithubOAuthCallback(c, &h, &env)
 		})
+		router.Post("/apple", func(c *fiber.Ctx) error {
+			return oauth.AppleOAuthCallback(c, &h, &env)
+		})
+		router.Get("/oidc/:provider", func(c *fiber.Ctx) error {
+			return oauth.OIDCCallback(c, &h, &env)
+		})
+		router.Post("/saml/:connection", func(c *fiber.Ctx) error {
+			return saml.SAMLCallback(c, &h, &env)
+		})
+	})
+	oauthG.Get("/metadata/saml/:connection", func(c *fiber.Ctx) error {
+		return saml.Metadata(c, &env)
+	})
+
+	oauthG.Get("/link/confirm", func(c *fiber.Ctx) error {
+		return oauth.ConfirmAccountLink(c, &h, &env)
+	})
+	oauthG.Post("/complete-signup", func(c *fiber.Ctx) error {
+		return oauth.CompleteSignup(c, &h, &env)
+	})
+
+	oauthG.Get("/authorize", func(c *fiber.Ctx) error {
+		return authorization.Authorize(c, &h, &env)
+	})
+	oauthG.Post("/token", func(c *fiber.Ctx) error {
+		return authorization.Token(c, &h, &env)
+	})
+	oauthG.Post("/register", func(c *fiber.Ctx) error {
+		return middleware.CheckRegistration(c, &h, &env)
+	}, func(c *fiber.Ctx) error {
+		return client.Register(c, &h)
+	})
+	oauthG.Route("/device", func(router fiber.Router) {
+		router.Post("/code", func(c *fiber.Ctx) error {
+			return device.Code(c, &h, &env)
+		})
+		router.Get("/verify", func(c *fiber.Ctx) error {
+			return middleware.CheckAuth(c, &h, &env)
+		}, func(c *fiber.Ctx) error {
+			return device.GetVerification(c, &h)
+		})
+		router.Post("/verify", func(c *fiber.Ctx) error {
+			return middleware.CheckAuth(c, &h, &env)
+		}, func(c *fiber.Ctx) error {
+			return device.Verify(c, &h)
+		})
+	})
+	oauthG.Route("/consent", func(router fiber.Router) {
+		router.Get("/:challenge", func(c *fiber.Ctx) error {
+			return middleware.CheckAuth(c, &h, &env)
+		}, func(c *fiber.Ctx) error {
+			return authorization.GetConsent(c, &h)
+		})
+		router.Post("/:challenge", func(c *fiber.Ctx) error {
+			return middleware.CheckAuth(c, &h, &env)
+		}, func(c *fiber.Ctx) error {
+			return authorization.Consent(c, &h)
+		})
 	})
 
 	userG := app.Group("/user", func(c *fiber.Ctx) error {
@@ -112,6 +228,9 @@ func main() {
 		router.Post("/name", func(c *fiber.Ctx) error {
 			return user.UpdateName(c, &h)
 		})
+		router.Post("/profile", func(c *fiber.Ctx) error {
+			return user.UpdateProfile(c, &h)
+		})
 	})
 	userG.Route("/auth", func(router fiber.Router) {
 		router.Get("/devices", func(c *fiber.Ctx) error {
@@ -124,6 +243,25 @@ func main() {
 			return user.LogoutFromDevice(c, &h)
 		})
 	})
+	userG.Route("/identities", func(router fiber.Router) {
+		router.Get("/", func(c *fiber.Ctx) error {
+			return user.GetIdentities(c, &h)
+		})
+		router.Post("/:provider", func(c *fiber.Ctx) error {
+			return user.LinkIdentity(c, &h, &env)
+		})
+		router.Delete("/:provider", func(c *fiber.Ctx) error {
+			return user.UnlinkIdentity(c, &h)
+		})
+	})
+	userG.Route("/consents", func(router fiber.Router) {
+		router.Get("/", func(c *fiber.Ctx) error {
+			return user.GetConsents(c, &h)
+		})
+		router.Delete("/:client_id", func(c *fiber.Ctx) error {
+			return user.RevokeConsent(c, &h)
+		})
+	})
 
 	emailG := app.Group("/email", func(c *fiber.Ctx) error {
 		return middleware.CheckAuth(c, &h, &env)
@@ -135,6 +273,50 @@ func main() {
 		router.Get("/resend", func(c *fiber.Ctx) error {
 			return email.ResendEmailConfirmation(c, &h, &env)
 		})
+		router.Post("/code", func(c *fiber.Ctx) error {
+			return email.ConfirmEmailWithCode(c, &h, &env)
+		})
+	})
+
+	adminG := app.Group("/admin", func(c *fiber.Ctx) error {
+		return middleware.CheckAuth(c, &h, &env)
+	}, func(c *fiber.Ctx) error {
+		return middleware.CheckAdmin(c, &h)
+	})
+	adminG.Route("/clients", func(router fiber.Router) {
+		router.Get("/", func(c *fiber.Ctx) error {
+			return client.List(c, &h)
+		})
+		router.Patch("/:client_id", func(c *fiber.Ctx) error {
+			return client.Update(c, &h)
+		})
+		router.Post("/:client_id/approve", func(c *fiber.Ctx) error {
+			return client.Approve(c, &h)
+		})
+		router.Post("/:client_id/secret", func(c *fiber.Ctx) error {
+			return client.RotateSecret(c, &h)
+		})
+		router.Delete("/:client_id", func(c *fiber.Ctx) error {
+			return client.Delete(c, &h)
+		})
+	})
+	adminG.Route("/emails", func(router fiber.Router) {
+		router.Get("/", func(c *fiber.Ctx) error {
+			return outbox.List(c, &h)
+		})
+		router.Get("/:id", func(c *fiber.Ctx) error {
+			return outbox.Get(c, &h)
+		})
+		router.Post("/:id/retry", func(c *fiber.Ctx) error {
+			return outbox.Retry(c, &h)
+		})
+	})
+
+	internalG := app.Group("/internal", func(c *fiber.Ctx) error {
+		return middleware.CheckInternal(c, &env)
+	})
+	internalG.Get("/users/:user_id/providers/:provider/token", func(c *fiber.Ctx) error {
+		return internal.GetProviderToken(c, &h, &env)
 	})
 
 	log.Errorf(app.Listen(fmt.Sprintf(":%s", env.Port)), nil)
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var chooserTemplate = template.Must(template.New("chooser").Parse(`<!DOCTYPE html>
+<html>
+<head><title>Mock provider</title></head>
+<body>
+<h1>Sign in to the mock provider</h1>
+<ul>
+{{range .Identities}}<li><a href="{{.URL}}">{{.Name}} ({{.Username}}, {{.Email}})</a></li>
+{{end}}</ul>
+<p><a href="{{.DenyURL}}">Deny the access</a></p>
+</body>
+</html>`))
+
+var formPostTemplate = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html>
+<body onload="document.forms[0].submit()">
+<form method="POST" action="{{.RedirectURI}}">
+{{range $key, $value := .Fields}}<input type="hidden" name="{{$key}}" value="{{$value}}">
+{{end}}<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body>
+</html>`))
+
+// authorize is a function that is used to log the user in with one of the identities and to send the
+// authorization code back to the client, the identity is picked with the login (or login_hint) parameter,
+// otherwise the identities are listed unless there is only one, deny=1 rejects the request
+func authorize(c *fiber.Ctx, path string, formPost bool) error {
+	redirectURI := c.Query("redirect_uri")
+	if _, err := url.ParseRequestURI(redirectURI); err != nil {
+		return c.Status(fiber.StatusBadRequest).SendString("redirect_uri is invalid")
+	}
+	state := c.Query("state")
+
+	if c.Query("deny") != "" {
+		return respond(c, redirectURI, formPost, map[string]string{
+			"error": "access_denied",
+			"state": state,
+		})
+	}
+
+	login := c.Query("login", c.Query("login_hint"))
+
+	var identity *Identity
+	switch {
+	case login != "":
+		identity = findIdentity(login)
+		if identity == nil {
+			return c.Status(fiber.StatusBadRequest).SendString("identity is not found")
+		}
+	case len(identities) == 1:
+		identity = &identities[0]
+	default:
+		return chooser(c, path)
+	}
+
+	code := issueCode(&grant{
+		identity:      identity,
+		clientID:      c.Query("client_id"),
+		redirectURI:   redirectURI,
+		codeChallenge: c.Query("code_challenge"),
+		method:        c.Query("code_challenge_method", "plain"),
+		nonce:         c.Query("nonce"),
+	})
+
+	fields := map[string]string{
+		"code":  code,
+		"state": state,
+	}
+	// INFO: Apple only sends the name of the user to the callback and only on the first login
+	if formPost {
+		user, err := json.Marshal(map[string]interface{}{
+			"name": map[string]string{
+				"firstName": identity.Name,
+			},
+		})
+		if err != nil {
+			return err
+		}
+		fields["user"] = string(user)
+	}
+
+	return respond(c, redirectURI, formPost, fields)
+}
+
+// respond is a function that is used to send the response of the authorization request to the redirect
+// URI, as a query (GET) or with an auto submitted form (form_post)
+func respond(c *fiber.Ctx, redirectURI string, formPost bool, fields map[string]string) error {
+	if formPost {
+		var b bytes.Buffer
+		err := formPostTemplate.Execute(&b, map[string]interface{}{
+			"RedirectURI": redirectURI,
+			"Fields":      fields,
+		})
+		if err != nil {
+			return err
+		}
+
+		c.Type("html")
+		return c.Send(b.Bytes())
+	}
+
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return err
+	}
+
+	query := u.Query()
+	for key, value := range fields {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	u.RawQuery = query.Encode()
+
+	return c.Redirect(u.String())
+}
+
+// chooser is a function that is used to list the identities that the user can log in with
+func chooser(c *fiber.Ctx, path string) error {
+	withParam := func(key, value string) string {
+		query, _ := url.ParseQuery(string(c.Request().URI().QueryString()))
+		query.Set(key, value)
+		return path + "?" + query.Encode()
+	}
+
+	type option struct {
+		URL      string
+		Name     string
+		Username string
+		Email    string
+	}
+
+	options := []option{}
+	for _, identity := range identities {
+		options = append(options, option{
+			URL:      withParam("login", identity.Username),
+			Name:     identity.Name,
+			Username: identity.Username,
+			Email:    identity.Email,
+		})
+	}
+
+	var b bytes.Buffer
+	err := chooserTemplate.Execute(&b, map[string]interface{}{
+		"Identities": options,
+		"DenyURL":    withParam("deny", "1"),
+	})
+	if err != nil {
+		return err
+	}
+
+	c.Type("html")
+	return c.Send(b.Bytes())
+}
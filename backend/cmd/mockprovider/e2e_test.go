@@ -0,0 +1,429 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/controllers"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+const e2eRedirectURL = "http://localhost:8080/oauth/sessions/oidc/mock"
+
+// e2e contains the mock provider that is served in-process and the backend that logs in with it, the
+// backend keeps the OAuth state and the sessions in an in-memory Redis and the queries of the database
+// are answered by db
+type e2e struct {
+	h       *initialize.H
+	env     *config.Env
+	db      sqlmock.Sqlmock
+	backend *fiber.App
+	client  *http.Client
+}
+
+func newE2E(t *testing.T) *e2e {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	publicURL = "http://" + listener.Addr().String()
+	identities = loadIdentities("")
+	signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID = randomString(8)
+
+	provider := fiber.New(fiber.Config{DisableStartupMessage: true})
+	routes(provider)
+	go func() {
+		_ = provider.Listener(listener)
+	}()
+	t.Cleanup(func() {
+		_ = provider.Shutdown()
+	})
+
+	conn, db, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+
+	gormDB, err := gorm.Open(postgres.New(postgres.Config{Conn: conn}), &gorm.Config{
+		Logger: gormLogger.Discard,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := miniredis.RunT(t)
+	h := &initialize.H{
+		DB: &initialize.DB{DB: gormDB},
+		R: &initialize.Redis{
+			RS: redis.NewClient(&redis.Options{Addr: m.Addr()}),
+		},
+	}
+
+	accessTokenPrivateKey, accessTokenPublicKey := newE2EKeys(t)
+	refreshTokenPrivateKey, refreshTokenPublicKey := newE2EKeys(t)
+	env := &config.Env{
+		AccessTokenPrivateKey:  accessTokenPrivateKey,
+		AccessTokenPublicKey:   accessTokenPublicKey,
+		AccessTokenExpires:     15 * time.Minute,
+		AccessTokenMaxAge:      15,
+		RefreshTokenPrivateKey: refreshTokenPrivateKey,
+		RefreshTokenPublicKey:  refreshTokenPublicKey,
+		RefreshTokenExpires:    time.Hour,
+		RefreshTokenMaxAge:     60,
+		OIDCProviders: []config.OIDCProvider{
+			{
+				Name:         "mock",
+				IssuerURL:    publicURL + "/oidc",
+				ClientID:     "auth",
+				ClientSecret: "secret",
+				RedirectURL:  e2eRedirectURL,
+				Scopes:       []string{"openid", "profile", "email"},
+				Claims: config.OIDCClaims{
+					Name:     "name",
+					Username: "preferred_username",
+					Email:    "email",
+					Picture:  "picture",
+					Profile:  "profile",
+					Locale:   "locale",
+				},
+			},
+		},
+	}
+
+	backend := fiber.New()
+	backend.Get("/oauth/redirect/oidc/:provider", func(c *fiber.Ctx) error {
+		return controllers.OAuth{}.RedirectToOIDCFlow(c, h, env)
+	})
+	backend.Get("/oauth/sessions/oidc/:provider", func(c *fiber.Ctx) error {
+		return controllers.OAuth{}.OIDCCallback(c, h, env)
+	})
+
+	return &e2e{
+		h:       h,
+		env:     env,
+		db:      db,
+		backend: backend,
+		client: &http.Client{
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// newE2EKeys is a function that is used to generate the base64 encoded PEM key pair that the tokens of the
+// backend are signed with
+func newE2EKeys(t *testing.T) (privateKey, publicKey string) {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	privateKey = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{
+		Type:  "RSA PRIVATE KEY",
+		Bytes: x509.MarshalPKCS1PrivateKey(key),
+	}))
+	publicKey = base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: public,
+	}))
+
+	return privateKey, publicKey
+}
+
+// authorize is a function that is used to start the login with the backend and to log in to the mock
+// provider with the given identity, the callback URL that the provider sends the browser to and the
+// state binding cookie of the browser are returned
+func (e *e2e) authorize(t *testing.T, query url.Values) (*url.URL, *http.Cookie) {
+	t.Helper()
+
+	res, err := e.backend.Test(httptest.NewRequest(fiber.MethodGet, "/oauth/redirect/oidc/mock", nil), -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != fiber.StatusFound {
+		t.Fatalf("expected the backend to redirect to the provider, got %d", res.StatusCode)
+	}
+
+	var binding *http.Cookie
+	for _, cookie := range res.Cookies() {
+		if cookie.Name == "oauth_state" {
+			binding = cookie
+		}
+	}
+	if binding == nil {
+		t.Fatal("expected the oauth_state cookie")
+	}
+
+	authorizeURL, err := url.Parse(res.Header.Get(fiber.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := authorizeURL.Query()
+	for key := range query {
+		params.Set(key, query.Get(key))
+	}
+	authorizeURL.RawQuery = params.Encode()
+
+	res, err = e.client.Get(authorizeURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != fiber.StatusFound {
+		t.Fatalf("expected the provider to redirect to the callback, got %d", res.StatusCode)
+	}
+
+	callback, err := url.Parse(res.Header.Get(fiber.HeaderLocation))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if callback.Scheme+"://"+callback.Host+callback.Path != e2eRedirectURL {
+		t.Fatalf("expected the provider to redirect to %s, got %s", e2eRedirectURL, callback)
+	}
+
+	return callback, binding
+}
+
+// callback is a function that is used to send the browser to the callback of the backend
+func (e *e2e) callback(t *testing.T, callback *url.URL, binding *http.Cookie) *http.Response {
+	t.Helper()
+
+	req := httptest.NewRequest(fiber.MethodGet, callback.RequestURI(), nil)
+	req.AddCookie(binding)
+
+	res, err := e.backend.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return res
+}
+
+// expectationsMet is a function that is used to wait for the queries of the backend, the expired sessions
+// are deleted in the background
+func (e *e2e) expectationsMet(t *testing.T) {
+	t.Helper()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		err := e.db.ExpectationsWereMet()
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestOIDCLogin(t *testing.T) {
+	e := newE2E(t)
+	userID := uuid.New()
+
+	// INFO: The returning user that the identity of alice is linked to, the sessions are created for it
+	e.db.MatchExpectationsInOrder(false)
+	e.db.ExpectQuery(`SELECT "users"\.".*" FROM "users" JOIN identities`).
+		WithArgs("mock", "1001").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "username", "email", "role", "provider", "verified", "profile_url", "locale"}).
+			AddRow(userID, "Alice Example", "alice", "alice@example.com", models.UserRole, "mock", true, publicURL+"/alice", "en"))
+	e.db.ExpectQuery(`SELECT \* FROM "sessions"`).
+		WillReturnRows(sqlmock.NewRows([]string{"token_id"}))
+	e.db.ExpectBegin()
+	e.db.ExpectQuery(`INSERT INTO "sessions"`).
+		WithArgs(sqlmock.AnyArg(), userID, "", "", "", "", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"login_at"}).AddRow(time.Now()))
+	e.db.ExpectCommit()
+
+	callback, binding := e.authorize(t, url.Values{"login": []string{"alice"}})
+
+	res := e.callback(t, callback, binding)
+	if res.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the user to be logged in, got %d", res.StatusCode)
+	}
+
+	cookies := map[string]string{}
+	for _, cookie := range res.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	if cookies["access_token"] == "" || cookies["refresh_token"] == "" {
+		t.Fatalf("expected the session cookies, got %v", cookies)
+	}
+
+	tokenClaims, err := utils.Token{}.ValidateAccessToken(e.h, cookies["access_token"], e.env.AccessTokenPublicKey)
+	if err != nil {
+		t.Fatalf("expected a valid access token, got %v", err)
+	}
+	if tokenClaims.UserID != userID.String() {
+		t.Fatalf("expected the session of %s, got %s", userID, tokenClaims.UserID)
+	}
+
+	e.expectationsMet(t)
+
+	// INFO: The state can only be used once
+	res = e.callback(t, callback, binding)
+	if res.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("expected the state to be rejected when it is used again, got %d", res.StatusCode)
+	}
+}
+
+func TestOIDCSignup(t *testing.T) {
+	e := newE2E(t)
+	userID := uuid.New()
+
+	// INFO: The identity of bob is not linked and there is no account with the email address or the
+	// username, so the user is created with the identity
+	e.db.MatchExpectationsInOrder(false)
+	e.db.ExpectQuery(`FROM "users" JOIN identities`).
+		WithArgs("mock", "1002").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	e.db.ExpectQuery(`SELECT "id","email","verified" FROM "users"`).
+		WithArgs("bob@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	e.db.ExpectQuery(`SELECT "username" FROM "users"`).
+		WithArgs("bob").
+		WillReturnRows(sqlmock.NewRows([]string{"username"}))
+	e.db.ExpectBegin()
+	e.db.ExpectQuery(`INSERT INTO "users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(userID))
+	e.db.ExpectQuery(`INSERT INTO "identities"`).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(uuid.New()))
+	e.db.ExpectCommit()
+	e.db.ExpectQuery(`SELECT \* FROM "sessions"`).
+		WillReturnRows(sqlmock.NewRows([]string{"token_id"}))
+	e.db.ExpectBegin()
+	e.db.ExpectQuery(`INSERT INTO "sessions"`).
+		WithArgs(sqlmock.AnyArg(), userID, "", "", "", "", "", sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"login_at"}).AddRow(time.Now()))
+	e.db.ExpectCommit()
+
+	callback, binding := e.authorize(t, url.Values{"login": []string{"bob"}})
+
+	res := e.callback(t, callback, binding)
+	if res.StatusCode != fiber.StatusOK {
+		t.Fatalf("expected the user to be signed up, got %d", res.StatusCode)
+	}
+
+	for _, cookie := range res.Cookies() {
+		if cookie.Name != "access_token" {
+			continue
+		}
+
+		tokenClaims, err := utils.Token{}.ValidateAccessToken(e.h, cookie.Value, e.env.AccessTokenPublicKey)
+		if err != nil {
+			t.Fatalf("expected a valid access token, got %v", err)
+		}
+		if tokenClaims.UserID != userID.String() {
+			t.Fatalf("expected the session of %s, got %s", userID, tokenClaims.UserID)
+		}
+
+		e.expectationsMet(t)
+		return
+	}
+
+	t.Fatal("expected the access_token cookie")
+}
+
+func TestOIDCLoginWithoutPKCEVerifier(t *testing.T) {
+	e := newE2E(t)
+	provider, _ := e.env.GetOIDCProvider("mock")
+
+	callback, binding := e.authorize(t, url.Values{"login": []string{"bob"}})
+	if _, err := (utils.State{}).Validate(e.h, callback.Query().Get("state"), binding.Value, provider.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (utils.OIDC{}).ExchangeCode(provider, callback.Query().Get("code"), "wrong-verifier"); err == nil {
+		t.Fatal("expected the code to be rejected without the code verifier of the flow")
+	}
+}
+
+func TestOIDCLoginCallbackErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   url.Values
+		binding func(*http.Cookie) *http.Cookie
+		status  int
+		err     error
+	}{
+		{
+			name:    "denied by the user",
+			query:   url.Values{"deny": []string{"1"}},
+			binding: func(cookie *http.Cookie) *http.Cookie { return cookie },
+			status:  fiber.StatusUnauthorized,
+			err:     errors.ErrAccessDenied,
+		},
+		{
+			name:  "started in another browser",
+			query: url.Values{"login": []string{"alice"}},
+			binding: func(cookie *http.Cookie) *http.Cookie {
+				return &http.Cookie{Name: cookie.Name, Value: "another-browser"}
+			},
+			status: fiber.StatusUnauthorized,
+			err:    errors.ErrInvalidState,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newE2E(t)
+
+			callback, binding := e.authorize(t, tt.query)
+			res := e.callback(t, callback, tt.binding(binding))
+			if res.StatusCode != tt.status {
+				t.Fatalf("expected %d, got %d", tt.status, res.StatusCode)
+			}
+
+			var body struct {
+				Status string `json:"status"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Status != tt.err.Error() {
+				t.Fatalf("expected %s, got %s", tt.err, body.Status)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/url"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// gitHubToken is a function that is used to exchange the authorization code for an access token like
+// GitHub does, the errors are sent with the 200 status code and the response is form encoded unless JSON
+// is accepted
+func gitHubToken(c *fiber.Ctx) error {
+	send := func(values url.Values) error {
+		if c.Accepts(fiber.MIMEApplicationForm, fiber.MIMEApplicationJSON) == fiber.MIMEApplicationJSON {
+			payload := map[string]string{}
+			for key := range values {
+				payload[key] = values.Get(key)
+			}
+			return c.JSON(payload)
+		}
+
+		c.Type("form")
+		return c.SendString(values.Encode())
+	}
+
+	g := redeemCode(c.FormValue("code"))
+	if g == nil || g.clientID != c.FormValue("client_id") || !verifyPKCE(g, c.FormValue("code_verifier")) {
+		return send(url.Values{
+			"error":             []string{"bad_verification_code"},
+			"error_description": []string{"The code passed is incorrect or expired."},
+		})
+	}
+
+	return send(url.Values{
+		"access_token": []string{issueToken(g.identity)},
+		"token_type":   []string{"bearer"},
+		"scope":        []string{"user:email"},
+	})
+}
+
+// gitHubUser is a function that is used to get the identity of the access token like the /user endpoint
+// of the GitHub API
+func gitHubUser(c *fiber.Ctx) error {
+	identity := bearer(c)
+	if identity == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Bad credentials",
+		})
+	}
+
+	payload := fiber.Map{
+		"id":         identity.gitHubID(),
+		"login":      identity.Username,
+		"name":       identity.Name,
+		"avatar_url": identity.AvatarURL,
+		"html_url":   identity.profileURL(),
+		"email":      nil,
+	}
+	if identity.Email != "" && identity.EmailVerified {
+		payload["email"] = identity.Email
+	}
+
+	return c.JSON(payload)
+}
+
+// gitHubEmails is a function that is used to get the email addresses of the identity of the access token
+// like the /user/emails endpoint of the GitHub API
+func gitHubEmails(c *fiber.Ctx) error {
+	identity := bearer(c)
+	if identity == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Bad credentials",
+		})
+	}
+
+	emails := []fiber.Map{}
+	if identity.Email != "" {
+		emails = append(emails, fiber.Map{
+			"email":      identity.Email,
+			"primary":    true,
+			"verified":   identity.EmailVerified,
+			"visibility": "public",
+		})
+	}
+
+	return c.JSON(emails)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/viper"
+)
+
+// Identity is a fake user of the mock provider
+type Identity struct {
+	// ID is the subject of the identity, it must be a number as it is also used as the GitHub user ID
+	ID            string `mapstructure:"id" validate:"required,number"`
+	Username      string `mapstructure:"username" validate:"required"`
+	Name          string `mapstructure:"name"`
+	Email         string `mapstructure:"email" validate:"omitempty,email"`
+	EmailVerified bool   `mapstructure:"email_verified"`
+	AvatarURL     string `mapstructure:"avatar_url"`
+	ProfileURL    string `mapstructure:"profile_url"`
+	Locale        string `mapstructure:"locale"`
+}
+
+// loadIdentities is a function that is used to load the fake identities from the given file, two
+// identities are used when the file is not given
+func loadIdentities(file string) []Identity {
+	if file == "" {
+		return []Identity{
+			{
+				ID:            "1001",
+				Username:      "alice",
+				Name:          "Alice Example",
+				Email:         "alice@example.com",
+				EmailVerified: true,
+				Locale:        "en",
+			},
+			{
+				ID:            "1002",
+				Username:      "bob",
+				Name:          "Bob Example",
+				Email:         "bob@example.com",
+				EmailVerified: false,
+				Locale:        "en",
+			},
+		}
+	}
+
+	v := viper.New()
+	v.SetConfigFile(file)
+	err := v.ReadInConfig()
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	var config struct {
+		Identities []Identity `mapstructure:"identities" validate:"required,min=1,dive"`
+	}
+	err = v.Unmarshal(&config)
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	log.Validatef(config)
+
+	return config.Identities
+}
+
+// findIdentity is a function that is used to get the identity with the given username, email or ID
+func findIdentity(login string) *Identity {
+	for i := range identities {
+		identity := &identities[i]
+		if identity.Username == login || identity.ID == login || (identity.Email != "" && identity.Email == login) {
+			return identity
+		}
+	}
+
+	return nil
+}
+
+// gitHubID is a function that is used to get the numeric GitHub user ID of the identity
+func (i *Identity) gitHubID() int64 {
+	id, _ := strconv.ParseInt(i.ID, 10, 64)
+	return id
+}
+
+// profileURL is a function that is used to get the profile URL of the identity, a page of the mock
+// provider is used when it is not configured
+func (i *Identity) profileURL() string {
+	if i.ProfileURL != "" {
+		return i.ProfileURL
+	}
+
+	return fmt.Sprintf("%s/%s", publicURL, i.Username)
+}
@@ -0,0 +1,172 @@
+// Mock OAuth / OpenID Connect provider to run the login flows locally and in the tests without
+// reaching GitHub, Apple or a real OpenID Connect provider
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VinukaThejana/go-utils/logger"
+	"github.com/gofiber/fiber/v2"
+	fiberLogger "github.com/gofiber/fiber/v2/middleware/logger"
+)
+
+const (
+	codeExpirationTime  = 5 * time.Minute
+	tokenExpirationTime = 1 * time.Hour
+)
+
+var (
+	log logger.Logger
+
+	publicURL  string
+	identities []Identity
+	signingKey *rsa.PrivateKey
+	keyID      string
+
+	mu            sync.Mutex
+	grants        = map[string]*grant{}
+	tokens        = map[string]*Identity{}
+	refreshTokens = map[string]*grant{}
+)
+
+// grant contains the authorization request that the code is issued for
+type grant struct {
+	identity      *Identity
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	method        string
+	nonce         string
+	expiresAt     time.Time
+}
+
+func main() {
+	addr := flag.String("addr", ":9090", "The address that the mock provider listens on")
+	url := flag.String("url", "http://localhost:9090", "The URL that the backend reaches the mock provider with")
+	identitiesFile := flag.String("identities", "", "The YAML file with the fake identities (see mockprovider.example.yaml)")
+	flag.Parse()
+
+	publicURL = strings.TrimSuffix(*url, "/")
+	identities = loadIdentities(*identitiesFile)
+
+	var err error
+	signingKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+	keyID = randomString(8)
+
+	app := fiber.New()
+	app.Use(fiberLogger.New())
+	routes(app)
+
+	log.Success(fmt.Sprintf("Mock provider is available at %s with %d identities", publicURL, len(identities)))
+	err = app.Listen(*addr)
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+}
+
+// routes is a function that is used to register the endpoints of the mock providers
+func routes(app *fiber.App) {
+	// INFO: GitHub, GITHUB_ROOT_URL=<url>/login/oauth/authorize, GITHUB_TOKEN_URL=<url>/login/oauth/access_token
+	// and GITHUB_API_URL=<url>
+	app.Get("/login/oauth/authorize", func(c *fiber.Ctx) error {
+		return authorize(c, "/login/oauth/authorize", false)
+	})
+	app.Post("/login/oauth/access_token", gitHubToken)
+	app.Get("/user", gitHubUser)
+	app.Get("/user/emails", gitHubEmails)
+
+	// INFO: Apple, APPLE_BASE_URL=<url>/apple
+	app.Get("/apple/auth/authorize", func(c *fiber.Ctx) error {
+		return authorize(c, "/apple/auth/authorize", true)
+	})
+	app.Post("/apple/auth/token", func(c *fiber.Ctx) error {
+		return token(c, "/apple")
+	})
+	app.Get("/apple/auth/keys", jwks)
+
+	// INFO: OpenID Connect, issuer_url: <url>/oidc
+	app.Get("/oidc/.well-known/openid-configuration", discovery)
+	app.Get("/oidc/authorize", func(c *fiber.Ctx) error {
+		return authorize(c, "/oidc/authorize", false)
+	})
+	app.Post("/oidc/token", func(c *fiber.Ctx) error {
+		return token(c, "/oidc")
+	})
+	app.Get("/oidc/jwks", jwks)
+	app.Get("/oidc/userinfo", userInfo)
+	app.Post("/oidc/userinfo", userInfo)
+}
+
+// issueCode is a function that is used to store the grant and to get the authorization code of it
+func issueCode(g *grant) string {
+	code := randomString(16)
+	g.expiresAt = time.Now().Add(codeExpirationTime)
+
+	mu.Lock()
+	grants[code] = g
+	mu.Unlock()
+
+	return code
+}
+
+// redeemCode is a function that is used to get the grant of the authorization code, the code can only
+// be used once
+func redeemCode(code string) *grant {
+	mu.Lock()
+	defer mu.Unlock()
+
+	g, ok := grants[code]
+	if !ok {
+		return nil
+	}
+	delete(grants, code)
+
+	if time.Now().After(g.expiresAt) {
+		return nil
+	}
+
+	return g
+}
+
+// issueToken is a function that is used to get an access token for the given identity
+func issueToken(identity *Identity) string {
+	accessToken := randomString(20)
+
+	mu.Lock()
+	tokens[accessToken] = identity
+	mu.Unlock()
+
+	return accessToken
+}
+
+// bearer is a function that is used to get the identity of the access token in the Authorization header
+func bearer(c *fiber.Ctx) *Identity {
+	accessToken := strings.TrimSpace(strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer"))
+	if accessToken == "" {
+		return nil
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	return tokens[accessToken]
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		log.Errorf(err, nil)
+	}
+
+	return hex.EncodeToString(b)
+}
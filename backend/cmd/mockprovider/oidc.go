@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// discovery is a function that is used to get the OpenID Connect discovery document of the mock provider
+func discovery(c *fiber.Ctx) error {
+	issuer := publicURL + "/oidc"
+
+	return c.JSON(fiber.Map{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"code_challenge_methods_supported":      []string{"S256", "plain"},
+	})
+}
+
+// token is a function that is used to exchange the authorization code or the refresh token for the
+// tokens of the OpenID Connect (and Apple) flow, the client secret is not checked
+func token(c *fiber.Ctx, issuerPath string) error {
+	clientID := c.FormValue("client_id")
+	if username, _, ok := basicAuth(c); ok {
+		clientID = username
+	}
+
+	var g *grant
+	switch c.FormValue("grant_type") {
+	case "authorization_code":
+		g = redeemCode(c.FormValue("code"))
+		if g != nil && (g.redirectURI != c.FormValue("redirect_uri") || !verifyPKCE(g, c.FormValue("code_verifier"))) {
+			g = nil
+		}
+	case "refresh_token":
+		mu.Lock()
+		g = refreshTokens[c.FormValue("refresh_token")]
+		mu.Unlock()
+		if g != nil {
+			refreshed := *g
+			refreshed.nonce = ""
+			g = &refreshed
+		}
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "unsupported_grant_type",
+		})
+	}
+
+	if g == nil || g.clientID != clientID {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid_grant",
+		})
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss": publicURL + issuerPath,
+		"aud": clientID,
+		"iat": now.Unix(),
+		"exp": now.Add(tokenExpirationTime).Unix(),
+	}
+	for key, value := range g.identity.claims() {
+		claims[key] = value
+	}
+	if g.nonce != "" {
+		claims["nonce"] = g.nonce
+	}
+
+	idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	idToken.Header["kid"] = keyID
+	signedIDToken, err := idToken.SignedString(signingKey)
+	if err != nil {
+		return err
+	}
+
+	refreshToken := randomString(20)
+	mu.Lock()
+	refreshTokens[refreshToken] = g
+	mu.Unlock()
+
+	return c.JSON(fiber.Map{
+		"access_token":  issueToken(g.identity),
+		"token_type":    "Bearer",
+		"expires_in":    int64(tokenExpirationTime.Seconds()),
+		"refresh_token": refreshToken,
+		"id_token":      signedIDToken,
+	})
+}
+
+// jwks is a function that is used to get the public key that the ID tokens are signed with
+func jwks(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"keys": []fiber.Map{
+			{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": "RS256",
+				"kid": keyID,
+				"n":   base64.RawURLEncoding.EncodeToString(signingKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(signingKey.E)).Bytes()),
+			},
+		},
+	})
+}
+
+// userInfo is a function that is used to get the claims of the identity of the access token
+func userInfo(c *fiber.Ctx) error {
+	identity := bearer(c)
+	if identity == nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	return c.JSON(identity.claims())
+}
+
+// claims is a function that is used to get the standard OpenID Connect claims of the identity
+func (i *Identity) claims() map[string]interface{} {
+	claims := map[string]interface{}{
+		"sub":                i.ID,
+		"name":               i.Name,
+		"preferred_username": i.Username,
+		"profile":            i.profileURL(),
+	}
+	if i.Email != "" {
+		claims["email"] = i.Email
+		claims["email_verified"] = i.EmailVerified
+	}
+	if i.AvatarURL != "" {
+		claims["picture"] = i.AvatarURL
+	}
+	if i.Locale != "" {
+		claims["locale"] = i.Locale
+	}
+
+	return claims
+}
+
+// verifyPKCE is a function that is used to check the code verifier against the code challenge of the
+// grant, the grants without a code challenge do not need a code verifier
+func verifyPKCE(g *grant, codeVerifier string) bool {
+	if g.codeChallenge == "" {
+		return true
+	}
+
+	challenge := codeVerifier
+	if g.method == "S256" {
+		sum := sha256.Sum256([]byte(codeVerifier))
+		challenge = base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+
+	return subtle.ConstantTimeCompare([]byte(challenge), []byte(g.codeChallenge)) == 1
+}
+
+// basicAuth is a function that is used to get the client credentials of the Authorization header, the
+// credentials are form encoded before they are base64 encoded (RFC 6749 section 2.3.1)
+func basicAuth(c *fiber.Ctx) (string, string, bool) {
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(authorization, "Basic ") {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+
+	username, password, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", false
+	}
+
+	username, err = url.QueryUnescape(username)
+	if err != nil {
+		return "", "", false
+	}
+	password, err = url.QueryUnescape(password)
+	if err != nil {
+		return "", "", false
+	}
+
+	return username, password, true
+}
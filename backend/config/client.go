@@ -0,0 +1,58 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// OAuthClient contains the configuration of an application that logs the users in with this service
+type OAuthClient struct {
+	ClientID string `mapstructure:"client_id" validate:"required,min=3,max=100"`
+	Name     string `mapstructure:"name" validate:"required,max=100"`
+	// ClientSecret is empty for public clients (single page and mobile applications)
+	ClientSecret string   `mapstructure:"client_secret" validate:"omitempty,min=32"`
+	RedirectURIs []string `mapstructure:"redirect_uris" validate:"dive,url"`
+	GrantTypes   []string `mapstructure:"grant_types" validate:"dive,oneof=authorization_code refresh_token urn:ietf:params:oauth:grant-type:device_code"`
+	Scopes       []string `mapstructure:"scopes"`
+}
+
+// loadOAuthClients is a function that is used to load the OAuth clients from the given file
+func (e *Env) loadOAuthClients() {
+	if e.OAuthClientsFile == "" {
+		return
+	}
+
+	v := viper.New()
+	v.SetConfigFile(e.OAuthClientsFile)
+	err := v.ReadInConfig()
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	err = v.UnmarshalKey("clients", &e.OAuthClients)
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	seen := map[string]bool{}
+	for i, client := range e.OAuthClients {
+		if seen[client.ClientID] {
+			log.Errorf(fmt.Errorf("OAuth client %s is defined more than once", client.ClientID), nil)
+		}
+		seen[client.ClientID] = true
+
+		if len(client.Scopes) == 0 {
+			e.OAuthClients[i].Scopes = []string{"openid", "profile", "email"}
+		}
+		if len(client.GrantTypes) == 0 {
+			e.OAuthClients[i].GrantTypes = []string{"authorization_code", "refresh_token"}
+		}
+
+		for _, grantType := range e.OAuthClients[i].GrantTypes {
+			if grantType == "authorization_code" && len(client.RedirectURIs) == 0 {
+				log.Errorf(fmt.Errorf("OAuth client %s must have at least one redirect URI", client.ClientID), nil)
+			}
+		}
+	}
+}
@@ -8,6 +8,11 @@ func (Enums) USER() string {
 	return "user"
 }
 
+// AUTHTIME contains the enum of the time that the user logged in
+func (Enums) AUTHTIME() string {
+	return "auth_time"
+}
+
 // ACCESSTOKENUUID contains the access token uuid enum
 func (Enums) ACCESSTOKENUUID() string {
 	return "access_token_uuid"
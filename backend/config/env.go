@@ -21,6 +21,8 @@ type Env struct {
 	RedisEmailURL       string `mapstructure:"REDIS_EMAIL_URL" validate:"required"`
 
 	Port string `mapstructure:"PORT" validate:"required"`
+	// PublicURL is the URL that this service is reachable at, it is the issuer of the ID tokens
+	PublicURL string `mapstructure:"PUBLIC_URL" validate:"required,url"`
 
 	AccessTokenPrivateKey string        `mapstructure:"ACCESS_TOKEN_PRIVATE_KEY" validate:"required"`
 	AccessTokenPublicKey  string        `mapstructure:"ACCESS_TOKEN_PUBLIC_KEY" validate:"required"`
@@ -32,13 +34,73 @@ type Env struct {
 	RefreshTokenExpires    time.Duration `mapstructure:"REFRESH_TOKEN_EXPIRED_IN" validate:"required"`
 	RefreshTokenMaxAge     int           `mapstructure:"REFRESH_TOKEN_MAXAGE" validate:"required"`
 
-	ResendAPIKey string `mapstructure:"RESEND_API_KEY" validate:"required"`
+	// Mailer is the backend that the emails are sent with, resend, smtp or sink (development) that writes the
+	// emails to EmailSinkDir as .eml files or to stdout, it must be chosen so that the emails are never
+	// dropped silently
+	Mailer       string `mapstructure:"MAILER" validate:"required,oneof=resend smtp sink"`
+	EmailFrom    string `mapstructure:"EMAIL_FROM" validate:"required"`
+	EmailReplyTo string `mapstructure:"EMAIL_REPLY_TO"`
+	ResendAPIKey string `mapstructure:"RESEND_API_KEY" validate:"required_if=Mailer resend"`
+	SMTPHost     string `mapstructure:"SMTP_HOST" validate:"required_if=Mailer smtp"`
+	SMTPPort     int    `mapstructure:"SMTP_PORT" validate:"min=1,max=65535"`
+	SMTPUsername string `mapstructure:"SMTP_USERNAME"`
+	SMTPPassword string `mapstructure:"SMTP_PASSWORD" validate:"required_with=SMTPUsername"`
+	// SMTPTLS is starttls (port 587), tls (port 465) or none (local relays like MailHog)
+	SMTPTLS      string `mapstructure:"SMTP_TLS" validate:"oneof=starttls tls none"`
+	EmailSinkDir string `mapstructure:"EMAIL_SINK_DIR"`
+	// EmailTemplatesDir contains the templates that replace the default templates of the emails with the same
+	// name (templates/emails)
+	EmailTemplatesDir string `mapstructure:"EMAIL_TEMPLATES_DIR" validate:"omitempty,dir"`
+
+	// OTPSecret is the key of the HMAC that the one time codes are stored with so that the six digit codes
+	// can not be guessed offline from the stored hashes
+	OTPSecret string `mapstructure:"OTP_SECRET" validate:"required,min=32"`
+
+	// PasswordResetURL is the page of the frontend that the user chooses the new password at, the token is
+	// given with the token query parameter, the password reset is disabled when it is not given
+	PasswordResetURL string `mapstructure:"PASSWORD_RESET_URL" validate:"omitempty,url"`
 
 	GithubClientID     string `mapstructure:"GITHUB_CLIENT_ID" validate:"required"`
 	GithubClientSecret string `mapstructure:"GITHUB_CLIENT_SECRET" validate:"required"`
 	GithubRedirectURL  string `mapstructure:"GITHUB_REDIRECT_URL" validate:"required"`
-	GithubFromURL      string `mapstructure:"GITHUB_FROM_URL" validate:"required"`
 	GithubRootURL      string `mapstructure:"GITHUB_ROOT_URL" validate:"required"`
+	// GithubTokenURL and GithubAPIURL are only changed to use a mock provider (cmd/mockprovider)
+	GithubTokenURL string `mapstructure:"GITHUB_TOKEN_URL" validate:"omitempty,url"`
+	GithubAPIURL   string `mapstructure:"GITHUB_API_URL" validate:"omitempty,url"`
+
+	OAuthReturnToAllowlist []string `mapstructure:"OAUTH_RETURN_TO_ALLOWLIST" validate:"dive,url"`
+	// OAuthCompletionURL is the page of the frontend that the user is sent to at the end of the OAuth flows
+	// when there is no return_to URL, the errors are sent with the error query parameter
+	OAuthCompletionURL string `mapstructure:"OAUTH_COMPLETION_URL" validate:"omitempty,url"`
+
+	AppleClientID    string `mapstructure:"APPLE_CLIENT_ID"`
+	AppleTeamID      string `mapstructure:"APPLE_TEAM_ID" validate:"required_with=AppleClientID"`
+	AppleKeyID       string `mapstructure:"APPLE_KEY_ID" validate:"required_with=AppleClientID"`
+	ApplePrivateKey  string `mapstructure:"APPLE_PRIVATE_KEY" validate:"required_with=AppleClientID"`
+	AppleRedirectURL string `mapstructure:"APPLE_REDIRECT_URL" validate:"required_with=AppleClientID"`
+	AppleBaseURL     string `mapstructure:"APPLE_BASE_URL" validate:"omitempty,url"`
+
+	ProviderTokenEncryptionKey string `mapstructure:"PROVIDER_TOKEN_ENCRYPTION_KEY" validate:"omitempty,base64"`
+	InternalAPIKey             string `mapstructure:"INTERNAL_API_KEY" validate:"omitempty,min=32"`
+
+	OIDCProvidersFile string         `mapstructure:"OIDC_PROVIDERS_FILE" validate:"omitempty,file"`
+	OIDCProviders     []OIDCProvider `mapstructure:"-" validate:"dive"`
+
+	SAMLConnectionsFile string           `mapstructure:"SAML_CONNECTIONS_FILE" validate:"omitempty,file"`
+	SAMLConnections     []SAMLConnection `mapstructure:"-" validate:"dive"`
+
+	LDAPConfigFile string `mapstructure:"LDAP_CONFIG_FILE" validate:"omitempty,file"`
+	LDAP           *LDAP  `mapstructure:"-" validate:"omitempty"`
+
+	OAuthClientsFile string        `mapstructure:"OAUTH_CLIENTS_FILE" validate:"omitempty,file"`
+	OAuthClients     []OAuthClient `mapstructure:"-" validate:"dive"`
+	OAuthLoginURL    string        `mapstructure:"OAUTH_LOGIN_URL" validate:"omitempty,url"`
+	OAuthConsentURL  string        `mapstructure:"OAUTH_CONSENT_URL" validate:"omitempty,url"`
+	OAuthDeviceURL   string        `mapstructure:"OAUTH_DEVICE_URL" validate:"omitempty,url"`
+
+	// OAuthRegistrationToken is the initial access token (RFC 7591) that the clients must send to register,
+	// anyone can register a client (it is pending until an admin approves it) when it is not given
+	OAuthRegistrationToken string `mapstructure:"OAUTH_REGISTRATION_TOKEN" validate:"omitempty,min=32"`
 }
 
 // Load is a function that is used to load the env variables from the env file
@@ -58,5 +120,30 @@ func (e *Env) Load() {
 		log.Errorf(err, nil)
 	}
 
+	if e.GithubTokenURL == "" {
+		e.GithubTokenURL = "https://github.com/login/oauth/access_token"
+	}
+	if e.GithubAPIURL == "" {
+		e.GithubAPIURL = "https://api.github.com"
+	}
+	if e.AppleBaseURL == "" {
+		e.AppleBaseURL = "https://appleid.apple.com"
+	}
+
+	if e.EmailReplyTo == "" {
+		e.EmailReplyTo = e.EmailFrom
+	}
+	if e.SMTPPort == 0 {
+		e.SMTPPort = 587
+	}
+	if e.SMTPTLS == "" {
+		e.SMTPTLS = "starttls"
+	}
+
+	e.loadOIDCProviders()
+	e.loadSAMLConnections()
+	e.loadLDAP()
+	e.loadOAuthClients()
+
 	log.Validatef(e)
 }
@@ -0,0 +1,135 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/spf13/viper"
+)
+
+// LDAP contains the configuration of the LDAP / Active Directory server that the internal staff log in
+// with through /auth/login (search then bind)
+type LDAP struct {
+	URL string `mapstructure:"url" validate:"required,url"`
+	// StartTLS upgrades the ldap:// connection to TLS before the credentials are sent
+	StartTLS bool `mapstructure:"start_tls"`
+	// BindDN and BindPassword are the credentials of the service account that searches for the users
+	BindDN       string `mapstructure:"bind_dn" validate:"required"`
+	BindPassword string `mapstructure:"bind_password" validate:"required"`
+	BaseDN       string `mapstructure:"base_dn" validate:"required"`
+	// UserFilter is the filter that the user is searched with, {username} is replaced with the escaped
+	// username or email address that the user logs in with
+	UserFilter string `mapstructure:"user_filter" validate:"required,contains={username}"`
+	// Domains are the email domains and Usernames are the usernames that are logged in with the directory,
+	// * logs in all the usernames with the directory
+	Domains    []string       `mapstructure:"domains"`
+	Usernames  []string       `mapstructure:"usernames"`
+	Attributes LDAPAttributes `mapstructure:"attributes"`
+	Roles      []LDAPRole     `mapstructure:"roles" validate:"dive"`
+}
+
+// LDAPRole maps the DN of a directory group to the role of its members
+type LDAPRole struct {
+	Group string `mapstructure:"group" validate:"required"`
+	Role  string `mapstructure:"role" validate:"required,oneof=user admin"`
+}
+
+// LDAPAttributes contains the names of the attributes of the directory entry that are mapped to the user
+type LDAPAttributes struct {
+	ID       string `mapstructure:"id"`
+	Username string `mapstructure:"username"`
+	Name     string `mapstructure:"name"`
+	Email    string `mapstructure:"email"`
+	Groups   string `mapstructure:"groups"`
+}
+
+// loadLDAP is a function that is used to load the LDAP configuration from the given file
+func (e *Env) loadLDAP() {
+	if e.LDAPConfigFile == "" {
+		return
+	}
+
+	v := viper.New()
+	v.SetConfigFile(e.LDAPConfigFile)
+	err := v.ReadInConfig()
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	e.LDAP = &LDAP{}
+	err = v.UnmarshalKey("ldap", e.LDAP)
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	if e.LDAP.UserFilter == "" {
+		e.LDAP.UserFilter = "(&(objectClass=person)(|(uid={username})(sAMAccountName={username})(mail={username})))"
+	}
+	if e.LDAP.Attributes.ID == "" {
+		e.LDAP.Attributes.ID = "entryUUID"
+	}
+	if e.LDAP.Attributes.Username == "" {
+		e.LDAP.Attributes.Username = "uid"
+	}
+	if e.LDAP.Attributes.Name == "" {
+		e.LDAP.Attributes.Name = "cn"
+	}
+	if e.LDAP.Attributes.Email == "" {
+		e.LDAP.Attributes.Email = "mail"
+	}
+	if e.LDAP.Attributes.Groups == "" {
+		e.LDAP.Attributes.Groups = "memberOf"
+	}
+
+	if len(e.LDAP.Domains) == 0 && len(e.LDAP.Usernames) == 0 {
+		log.Errorf(fmt.Errorf("LDAP must be used for at least one domain or username"), nil)
+	}
+}
+
+// Handles is a function that is used to check wether the user with the given username or email must be
+// logged in with the directory
+func (l *LDAP) Handles(username, email string) bool {
+	if username != "" {
+		for _, u := range l.Usernames {
+			if u == "*" || strings.EqualFold(u, username) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	_, domain, found := strings.Cut(email, "@")
+	if !found {
+		return false
+	}
+
+	for _, d := range l.Domains {
+		if strings.EqualFold(d, domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Role is a function that is used to get the role of the user from the DNs of the groups that the user
+// is a member of, the admin role wins over the other roles
+func (l *LDAP) Role(groups []string) string {
+	role := models.UserRole
+	for _, group := range groups {
+		for _, r := range l.Roles {
+			if !strings.EqualFold(r.Group, group) {
+				continue
+			}
+
+			if r.Role == models.AdminRole {
+				return r.Role
+			}
+			role = r.Role
+		}
+	}
+
+	return role
+}
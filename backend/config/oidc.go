@@ -0,0 +1,97 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+)
+
+// OIDCProvider contains the configuration of a generic OpenID Connect provider
+// (Keycloak, Okta, Azure AD, Authentik ...)
+type OIDCProvider struct {
+	Name         string     `mapstructure:"name" validate:"required,lowercase,alphanum,min=2,max=30"`
+	IssuerURL    string     `mapstructure:"issuer_url" validate:"required,url"`
+	ClientID     string     `mapstructure:"client_id" validate:"required"`
+	ClientSecret string     `mapstructure:"client_secret" validate:"required"`
+	RedirectURL  string     `mapstructure:"redirect_url" validate:"required,url"`
+	Scopes       []string   `mapstructure:"scopes"`
+	Claims       OIDCClaims `mapstructure:"claims"`
+}
+
+// OIDCClaims contains the names of the claims that are mapped to the user
+type OIDCClaims struct {
+	Name     string `mapstructure:"name"`
+	Username string `mapstructure:"username"`
+	Email    string `mapstructure:"email"`
+	Picture  string `mapstructure:"picture"`
+	Profile  string `mapstructure:"profile"`
+	Locale   string `mapstructure:"locale"`
+}
+
+// reservedProviders contains the provider names that cannot be used by OIDC providers
+var reservedProviders = []string{"local", "github", "apple", "ldap"}
+
+// loadOIDCProviders is a function that is used to load the OIDC providers from the given file
+func (e *Env) loadOIDCProviders() {
+	if e.OIDCProvidersFile == "" {
+		return
+	}
+
+	v := viper.New()
+	v.SetConfigFile(e.OIDCProvidersFile)
+	err := v.ReadInConfig()
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	err = v.UnmarshalKey("providers", &e.OIDCProviders)
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	seen := map[string]bool{}
+	for i, provider := range e.OIDCProviders {
+		for _, reserved := range reservedProviders {
+			if provider.Name == reserved {
+				log.Errorf(fmt.Errorf("OIDC provider name %s is reserved", provider.Name), nil)
+			}
+		}
+		if seen[provider.Name] {
+			log.Errorf(fmt.Errorf("OIDC provider %s is defined more than once", provider.Name), nil)
+		}
+		seen[provider.Name] = true
+
+		if len(provider.Scopes) == 0 {
+			e.OIDCProviders[i].Scopes = []string{"openid", "profile", "email"}
+		}
+		if provider.Claims.Name == "" {
+			e.OIDCProviders[i].Claims.Name = "name"
+		}
+		if provider.Claims.Username == "" {
+			e.OIDCProviders[i].Claims.Username = "preferred_username"
+		}
+		if provider.Claims.Email == "" {
+			e.OIDCProviders[i].Claims.Email = "email"
+		}
+		if provider.Claims.Picture == "" {
+			e.OIDCProviders[i].Claims.Picture = "picture"
+		}
+		if provider.Claims.Profile == "" {
+			e.OIDCProviders[i].Claims.Profile = "profile"
+		}
+		if provider.Claims.Locale == "" {
+			e.OIDCProviders[i].Claims.Locale = "locale"
+		}
+	}
+}
+
+// GetOIDCProvider is a function that is used to get the OIDC provider with the given name
+func (e *Env) GetOIDCProvider(name string) (*OIDCProvider, bool) {
+	for i := range e.OIDCProviders {
+		if e.OIDCProviders[i].Name == name {
+			return &e.OIDCProviders[i], true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// samlRedirectBinding is the binding that the authentication requests are sent to the IdP with
+const samlRedirectBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-Redirect"
+
+// SAMLConnection contains the configuration of a SAML 2.0 identity provider (Okta, Azure AD, ADFS ...)
+// that this service logs the users in with as the service provider (SP)
+type SAMLConnection struct {
+	Name string `mapstructure:"name" validate:"required,lowercase,alphanum,min=2,max=30"`
+	// EntityID is the entity ID of this service (SP) that is registered with the IdP
+	EntityID string `mapstructure:"entity_id" validate:"required"`
+	// ACSURL is the URL that the IdP posts the responses to (/oauth/sessions/saml/<name>)
+	ACSURL          string         `mapstructure:"acs_url" validate:"required,url"`
+	IdPMetadataFile string         `mapstructure:"idp_metadata_file" validate:"required,file"`
+	Attributes      SAMLAttributes `mapstructure:"attributes"`
+	// TrustEmail marks the email addresses that are sent by the IdP as verified, only enable it for IdPs
+	// that verify the email addresses of their users
+	TrustEmail bool `mapstructure:"trust_email"`
+
+	// IdPEntityID, IdPSSOURL and IdPCertificates are read from the IdP metadata
+	IdPEntityID     string              `mapstructure:"-"`
+	IdPSSOURL       string              `mapstructure:"-"`
+	IdPCertificates []*x509.Certificate `mapstructure:"-"`
+}
+
+// SAMLAttributes contains the names of the attributes of the assertion that are mapped to the user,
+// the NameID is used as the email when the email attribute is not sent
+type SAMLAttributes struct {
+	Name     string `mapstructure:"name"`
+	Username string `mapstructure:"username"`
+	Email    string `mapstructure:"email"`
+}
+
+type samlEntityDescriptor struct {
+	EntityID         string `xml:"entityID,attr"`
+	IDPSSODescriptor struct {
+		KeyDescriptors []struct {
+			Use          string   `xml:"use,attr"`
+			Certificates []string `xml:"KeyInfo>X509Data>X509Certificate"`
+		} `xml:"KeyDescriptor"`
+		SingleSignOnServices []struct {
+			Binding  string `xml:"Binding,attr"`
+			Location string `xml:"Location,attr"`
+		} `xml:"SingleSignOnService"`
+	} `xml:"IDPSSODescriptor"`
+}
+
+// loadSAMLConnections is a function that is used to load the SAML connections from the given file
+// along with the metadata of their IdPs
+func (e *Env) loadSAMLConnections() {
+	if e.SAMLConnectionsFile == "" {
+		return
+	}
+
+	v := viper.New()
+	v.SetConfigFile(e.SAMLConnectionsFile)
+	err := v.ReadInConfig()
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	err = v.UnmarshalKey("connections", &e.SAMLConnections)
+	if err != nil {
+		log.Errorf(err, nil)
+	}
+
+	seen := map[string]bool{}
+	for i, connection := range e.SAMLConnections {
+		for _, reserved := range reservedProviders {
+			if connection.Name == reserved {
+				log.Errorf(fmt.Errorf("SAML connection name %s is reserved", connection.Name), nil)
+			}
+		}
+		if _, ok := e.GetOIDCProvider(connection.Name); ok || seen[connection.Name] {
+			log.Errorf(fmt.Errorf("SAML connection %s is defined more than once or used by an OIDC provider", connection.Name), nil)
+		}
+		seen[connection.Name] = true
+
+		if connection.Attributes.Name == "" {
+			e.SAMLConnections[i].Attributes.Name = "name"
+		}
+		if connection.Attributes.Username == "" {
+			e.SAMLConnections[i].Attributes.Username = "username"
+		}
+		if connection.Attributes.Email == "" {
+			e.SAMLConnections[i].Attributes.Email = "email"
+		}
+
+		if connection.IdPMetadataFile == "" {
+			continue
+		}
+
+		err = e.SAMLConnections[i].loadIdPMetadata()
+		if err != nil {
+			log.Errorf(fmt.Errorf("SAML connection %s : %s", connection.Name, err.Error()), nil)
+		}
+	}
+}
+
+// loadIdPMetadata is a function that is used to read the entity ID, the single sign on URL and the signing
+// certificates of the IdP from the metadata XML
+func (connection *SAMLConnection) loadIdPMetadata() error {
+	data, err := os.ReadFile(connection.IdPMetadataFile)
+	if err != nil {
+		return err
+	}
+
+	var metadata samlEntityDescriptor
+	if err = xml.Unmarshal(data, &metadata); err != nil {
+		return err
+	}
+
+	connection.IdPEntityID = metadata.EntityID
+	for _, service := range metadata.IDPSSODescriptor.SingleSignOnServices {
+		if service.Binding == samlRedirectBinding {
+			connection.IdPSSOURL = service.Location
+		}
+	}
+
+	for _, key := range metadata.IDPSSODescriptor.KeyDescriptors {
+		if key.Use != "" && key.Use != "signing" {
+			continue
+		}
+
+		for _, encoded := range key.Certificates {
+			der, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(encoded), ""))
+			if err != nil {
+				return err
+			}
+
+			certificate, err := x509.ParseCertificate(der)
+			if err != nil {
+				return err
+			}
+
+			connection.IdPCertificates = append(connection.IdPCertificates, certificate)
+		}
+	}
+
+	if connection.IdPEntityID == "" {
+		return fmt.Errorf("entityID is not found in the IdP metadata")
+	}
+	if connection.IdPSSOURL == "" {
+		return fmt.Errorf("HTTP-Redirect SingleSignOnService is not found in the IdP metadata")
+	}
+	if len(connection.IdPCertificates) == 0 {
+		return fmt.Errorf("signing certificate is not found in the IdP metadata")
+	}
+
+	return nil
+}
+
+// GetSAMLConnection is a function that is used to get the SAML connection with the given name
+func (e *Env) GetSAMLConnection(name string) (*SAMLConnection, bool) {
+	for i := range e.SAMLConnections {
+		if e.SAMLConnections[i].Name == name {
+			return &e.SAMLConnections[i], true
+		}
+	}
+
+	return nil, false
+}
@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"context"
+	"strings"
 	"time"
 
 	"github.com/VinukaThejana/auth/backend/config"
@@ -11,6 +13,7 @@ import (
 	"github.com/VinukaThejana/auth/backend/services"
 	"github.com/VinukaThejana/auth/backend/utils"
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -69,7 +72,11 @@ func (Auth) Register(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 		})
 	}
 
-	go utils.Email{}.SendConfirmation(h, env, newUser.Email, newUser.ID.String())
+	// INFO: The account is created even if the confirmation could not be queued, the user can ask for it again
+	err = utils.Email{}.SendConfirmation(h, env, newUser.Email, newUser.ID.String())
+	if err != nil {
+		log.Error(err, nil)
+	}
 
 	return c.Status(fiber.StatusOK).JSON(response{
 		Status: errors.Okay,
@@ -93,6 +100,13 @@ func (Auth) Login(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 		})
 	}
 
+	if env.LDAP != nil && env.LDAP.Handles(payload.Username, payload.Email) {
+		done, err := ldapLogin(c, h, env, payload)
+		if done || err != nil {
+			return err
+		}
+	}
+
 	var user models.User
 	if payload.Username != "" {
 		result := h.DB.DB.First(&user, "username = ?", payload.Username)
@@ -124,10 +138,6 @@ func (Auth) Login(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 		}
 	}
 
-	go func() {
-		utils.Token{}.DeleteExpiredTokens(h, user.ID.String())
-	}()
-
 	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password))
 	if err != nil {
 		log.Error(err, nil)
@@ -136,7 +146,7 @@ func (Auth) Login(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 		})
 	}
 
-	accessTokenDetails, err := utils.Token{}.CreateAccessToken(h, user.ID.String(), env.AccessTokenPrivateKey, env.AccessTokenExpires)
+	err = createSession(c, h, env, user.ID.String())
 	if err != nil {
 		log.Error(err, nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(response{
@@ -144,53 +154,59 @@ func (Auth) Login(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 		})
 	}
 
-	refreshTokenDetails, err := utils.Token{}.CreateRefreshToken(h, user.ID.String(), env.RefreshTokenPrivateKey, env.RefreshTokenExpires, struct {
-		IPAddress       string
-		Location        string
-		Device          string
-		OS              string
-		AccessTokenUUID string
-	}{
-		AccessTokenUUID: accessTokenDetails.TokenUUID,
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
 	})
+}
+
+// ldapLogin is a function that is used to log the user in with the directory, the local account is used
+// instead (done is false) when the user is not found in the directory
+func ldapLogin(c *fiber.Ctx, h *initialize.H, env *config.Env, payload *schemas.LoginInput) (done bool, err error) {
+	login := payload.Username
+	if login == "" {
+		login = payload.Email
+	}
+
+	profile, groups, err := utils.LDAP{}.Authenticate(env.LDAP, login, payload.Password)
+	if err != nil {
+		switch err {
+		case errors.ErrDirectoryUserNotFound:
+			return false, nil
+		case errors.ErrIncorrectCredentials:
+			return true, c.Status(fiber.StatusUnauthorized).JSON(response{
+				Status: errors.ErrUnauthorized.Error(),
+			})
+		default:
+			log.Error(err, nil)
+			return true, c.Status(fiber.StatusInternalServerError).JSON(response{
+				Status: errors.ErrInternalServerError.Error(),
+			})
+		}
+	}
+
+	user, err := services.LDAP{}.LDAPLogin(h, env.LDAP, *profile, groups)
 	if err != nil {
+		if err == errors.ErrEmailAlreadyUsed || err == errors.ErrAddAUsername {
+			return true, c.Status(fiber.StatusBadRequest).JSON(response{
+				Status: err.Error(),
+			})
+		}
+
 		log.Error(err, nil)
-		return c.Status(fiber.StatusInternalServerError).JSON(response{
+		return true, c.Status(fiber.StatusInternalServerError).JSON(response{
 			Status: errors.ErrInternalServerError.Error(),
 		})
 	}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "access_token",
-		Value:    *accessTokenDetails.Token,
-		Path:     "/",
-		MaxAge:   env.AccessTokenMaxAge * 60,
-		Secure:   false,
-		HTTPOnly: true,
-		Domain:   "localhost",
-	})
-
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    *refreshTokenDetails.Token,
-		Path:     "/",
-		MaxAge:   env.RefreshTokenMaxAge * 60,
-		Secure:   false,
-		HTTPOnly: true,
-		Domain:   "localhost",
-	})
-
-	c.Cookie(&fiber.Cookie{
-		Name:     "logged_in",
-		Value:    "true",
-		Path:     "/",
-		MaxAge:   env.AccessTokenMaxAge * 60,
-		Secure:   false,
-		HTTPOnly: false,
-		Domain:   "localhost",
-	})
+	err = createSession(c, h, env, user.ID.String())
+	if err != nil {
+		log.Error(err, nil)
+		return true, c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
 
-	return c.Status(fiber.StatusOK).JSON(response{
+	return true, c.Status(fiber.StatusOK).JSON(response{
 		Status: errors.Okay,
 	})
 }
@@ -224,8 +240,24 @@ func (Auth) RefreshToken(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 		})
 	}
 
-	accessTokenDetails, err := utils.Token{}.CreateAccessToken(h, tokenClaims.UserID, env.AccessTokenPrivateKey, env.AccessTokenExpires)
+	accessTokenDetails, err := utils.Token{}.CreateAccessToken(h, tokenClaims.UserID, env.AccessTokenPrivateKey, env.AccessTokenExpires, tokenClaims.AuthTime)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	err = utils.Token{}.SetAccessToken(h, tokenClaims.TokenUUID, accessTokenDetails.TokenUUID)
 	if err != nil {
+		// INFO: The access token that the session does not know of could not be revoked with it
+		h.R.RS.Del(context.TODO(), accessTokenDetails.TokenUUID)
+		if err == errors.ErrUnauthorized {
+			return c.Status(fiber.StatusUnauthorized).JSON(response{
+				Status: err.Error(),
+			})
+		}
+
 		log.Error(err, nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(response{
 			Status: errors.ErrInternalServerError.Error(),
@@ -354,3 +386,431 @@ func (Auth) CheckUsername(c *fiber.Ctx, h *initialize.H) error {
 		Available: false,
 	})
 }
+
+// ForgotPassword is a function that is used to send the password reset email to the user, the response is
+// the same whether an account with the email exists or not
+func (Auth) ForgotPassword(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	if env.PasswordResetURL == "" {
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: errors.ErrNotFound.Error(),
+		})
+	}
+
+	var payload *schemas.ForgotPasswordInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	if err := payload.Validate(); err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	ok, err := utils.Password{}.AllowReset(h, payload.Email, c.IP())
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+	if !ok {
+		return c.Status(fiber.StatusTooManyRequests).JSON(response{
+			Status: errors.ErrTooManyRequests.Error(),
+		})
+	}
+
+	// INFO: The email is sent in the background so that the time of the response does not tell whether
+	// the account exists, the email is copied as the values of the request are only valid until the handler
+	// returns
+	email := strings.Clone(payload.Email)
+	go func() {
+		var user models.User
+		result := h.DB.DB.First(&user, "email = ?", email)
+		if result.Error != nil {
+			if result.Error != gorm.ErrRecordNotFound {
+				log.Error(result.Error, nil)
+			}
+			return
+		}
+
+		// INFO: The passwords of the directory users are managed by the directory
+		if user.Provider != nil && *user.Provider == models.LDAPProvider {
+			return
+		}
+
+		err := utils.Email{}.SendPasswordReset(h, env, user.Email, user.ID.String())
+		if err != nil {
+			log.Error(err, nil)
+		}
+	}()
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
+// ResetPassword is a function that is used to set the new password of the user with the token of the
+// password reset email, all the sessions of the user are revoked
+func (Auth) ResetPassword(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	if env.PasswordResetURL == "" {
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: errors.ErrNotFound.Error(),
+		})
+	}
+
+	var payload *schemas.ResetPasswordInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	if err := payload.Validate(); err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	if payload.Password != payload.PasswordConfirmation {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	userID, err := utils.Password{}.ConsumeResetToken(h, payload.Token)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrPasswordResetExpired.Error(),
+		})
+	}
+
+	var user models.User
+	result := h.DB.DB.First(&user, "id = ?", userID)
+	if result.Error != nil {
+		if result.Error == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusBadRequest).JSON(response{
+				Status: errors.ErrPasswordResetExpired.Error(),
+			})
+		}
+
+		log.Error(result.Error, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(payload.Password), bcrypt.DefaultCost)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	// INFO: The user proved that they own the email by following the link
+	err = h.DB.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+		"password": string(hashedPassword),
+		"verified": true,
+	}).Error
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	err = utils.Token{}.DeleteUserTokens(h, userID)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	err = services.Audit{}.Record(h, userID, models.AuditPasswordReset, "", c.IP())
+	if err != nil {
+		log.Error(err, nil)
+	}
+
+	err = utils.Email{}.SendNotification(h, user.Email, "Your password was changed", "The password of your account was reset and you were signed out of every device. If you did not do this, reset your password again and contact us right away.")
+	if err != nil {
+		log.Error(err, nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
+// MagicLink is a function that is used to send the link to log in without the password to the user, the
+// link is bound to the browser that requested it with a cookie and the response is the same whether an
+// account with the email exists or not
+func (Auth) MagicLink(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	var payload *schemas.MagicLinkInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	if err := payload.Validate(); err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	ok, err := utils.MagicLink{}.Allow(h, payload.Email, c.IP())
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+	if !ok {
+		return c.Status(fiber.StatusTooManyRequests).JSON(response{
+			Status: errors.ErrTooManyRequests.Error(),
+		})
+	}
+
+	// INFO: The nonce of the browser is kept so that the links that were requested earlier keep working
+	nonce := c.Cookies("magic_link")
+	if len(nonce) < 32 || len(nonce) > 100 {
+		nonce, err = utils.RandomString(32)
+		if err != nil {
+			log.Error(err, nil)
+			return c.Status(fiber.StatusInternalServerError).JSON(response{
+				Status: errors.ErrInternalServerError.Error(),
+			})
+		}
+	}
+	c.Cookie(&fiber.Cookie{
+		Name:     "magic_link",
+		Value:    nonce,
+		Path:     "/auth/magic-link",
+		MaxAge:   int(utils.MagicLinkExpirationTime.Seconds()),
+		Secure:   false,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	// INFO: The link is sent in the background so that the time of the response does not tell whether the
+	// account exists, the values of the request are copied as they are only valid until the handler returns
+	email := strings.Clone(payload.Email)
+	nonce = strings.Clone(nonce)
+	go func() {
+		var user models.User
+		result := h.DB.DB.First(&user, "email = ?", email)
+		if result.Error != nil {
+			if result.Error != gorm.ErrRecordNotFound {
+				log.Error(result.Error, nil)
+			}
+			return
+		}
+
+		// INFO: The directory users log in with the directory
+		if user.Provider != nil && *user.Provider == models.LDAPProvider {
+			return
+		}
+
+		err := utils.Email{}.SendMagicLink(h, env, user.Email, user.ID.String(), nonce)
+		if err != nil {
+			log.Error(err, nil)
+		}
+	}()
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
+// VerifyMagicLink is a function that is used to log the user in with the magic link, the email of the
+// user is verified as the user proved that they own it by following the link
+func (Auth) VerifyMagicLink(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	userID, err := utils.MagicLink{}.Consume(h, c.Query("token"), c.Cookies("magic_link"))
+	if err != nil {
+		if err == errors.ErrMagicLinkExpired || err == errors.ErrMagicLinkBrowserMismatch {
+			return oauthCallbackError(c, env, nil, fiber.StatusUnauthorized, err, nil)
+		}
+
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, nil, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	err = services.User{}.VerifyByEmail(h, userID)
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, nil, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	err = createSession(c, h, env, userID)
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, nil, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "magic_link",
+		Path:     "/auth/magic-link",
+		MaxAge:   -1,
+		HTTPOnly: true,
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	return completeOAuthFlow(c, env, nil)
+}
+
+// RequestOTP is a function that is used to send the one time code to log in without the password to the
+// user, for the clients that can not follow the magic links, the response is the same whether an account
+// with the email exists or not
+func (Auth) RequestOTP(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	var payload *schemas.OTPRequestInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	if err := payload.Validate(); err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	ok, err := utils.OTP{}.AllowIP(h, c.IP())
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+	if !ok {
+		return c.Status(fiber.StatusTooManyRequests).JSON(response{
+			Status: errors.ErrTooManyRequests.Error(),
+		})
+	}
+
+	// INFO: The code is sent in the background and the resend limits of the user are not reported so that
+	// the response does not reveal the account, the email is copied as the values of the request are only
+	// valid until the handler returns
+	email := strings.Clone(payload.Email)
+	go func() {
+		var user models.User
+		result := h.DB.DB.First(&user, "email = ?", email)
+		if result.Error != nil {
+			if result.Error != gorm.ErrRecordNotFound {
+				log.Error(result.Error, nil)
+			}
+			return
+		}
+
+		if user.Provider != nil && *user.Provider == models.LDAPProvider {
+			return
+		}
+
+		ok, err := utils.OTP{}.AllowResend(h, utils.OTPLogin, user.ID.String())
+		if err != nil {
+			log.Error(err, nil)
+		}
+		if !ok {
+			return
+		}
+
+		err = utils.Email{}.SendLoginCode(h, env, user.Email, user.ID.String())
+		if err != nil {
+			log.Error(err, nil)
+		}
+	}()
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
+// VerifyOTP is a function that is used to log the user in with the one time code, the email of the user is
+// verified as the user proved that they own it by entering the code, the response is the same for an
+// unknown email and a wrong, expired or used up code
+func (Auth) VerifyOTP(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	var payload *schemas.OTPVerifyInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	if err := payload.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	ok, err := utils.OTP{}.AllowVerifyIP(h, c.IP())
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+	if !ok {
+		return c.Status(fiber.StatusTooManyRequests).JSON(response{
+			Status: errors.ErrTooManyRequests.Error(),
+		})
+	}
+
+	// INFO: The unknown emails are checked against a code that never exists and all the failures get the
+	// same response so that the response does not reveal the account or whether a code was sent to it
+	var user models.User
+	userID := uuid.Nil.String()
+	result := h.DB.DB.First(&user, "email = ?", payload.Email)
+	if result.Error != nil && result.Error != gorm.ErrRecordNotFound {
+		log.Error(result.Error, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+	if result.Error == nil {
+		userID = user.ID.String()
+	}
+
+	email, err := utils.OTP{}.Verify(h, env, utils.OTPLogin, userID, payload.Code)
+	if err != nil && err != errors.ErrInvalidOTP && err != errors.ErrOTPExpired {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	// INFO: The code was not accepted, the account does not exist or its email was changed after the code
+	// was sent
+	if err != nil || result.Error != nil || email != user.Email {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrInvalidOTP.Error(),
+		})
+	}
+
+	err = services.User{}.VerifyByEmail(h, user.ID.String())
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	err = createSession(c, h, env, user.ID.String())
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
@@ -0,0 +1,544 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/services"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+)
+
+// Authorization contains the controllers of the OAuth 2.0 authorization server that lets other
+// applications log the users in with this service
+type Authorization struct{}
+
+// Authorize is a function that is used to authorize the OAuth client to act on behalf of the logged in
+// user, the client gets an authorization code at the redirect URI (authorization code grant with PKCE)
+func (Authorization) Authorize(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	var payload schemas.AuthorizeInput
+	if err := c.QueryParser(&payload); err != nil {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidRequest, "")
+	}
+
+	client, err := services.Client{}.Get(h, payload.ClientID)
+	if err != nil {
+		if err == errors.ErrClientNotFound {
+			return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidClient, "")
+		}
+
+		log.Error(err, nil)
+		return authorizationError(c, fiber.StatusInternalServerError, errors.ErrServerError, "")
+	}
+
+	// INFO: The user must never be sent to a redirect URI that is not registered with the client
+	if !(services.Client{}.IsRedirectURIAllowed(client, payload.RedirectURI)) {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidRequest, errors.ErrInvalidRedirectURI.Error())
+	}
+
+	if payload.ResponseType != "code" {
+		return authorizationRedirectError(c, payload, errors.ErrUnsupportedResponseType, "")
+	}
+	if !(services.Client{}.IsGrantTypeAllowed(client, "authorization_code")) {
+		return authorizationRedirectError(c, payload, errors.ErrUnauthorizedClient, "")
+	}
+
+	if payload.CodeChallenge == "" || payload.CodeChallengeMethod != "S256" {
+		return authorizationRedirectError(c, payload, errors.ErrInvalidRequest, "code_challenge with the S256 code_challenge_method is required")
+	}
+
+	scope, err := services.Client{}.AllowedScope(client, payload.Scope)
+	if err != nil {
+		return authorizationRedirectError(c, payload, errors.ErrInvalidScope, "")
+	}
+
+	tokenClaims, err := utils.Token{}.ValidateAccessToken(h, c.Cookies("access_token"), env.AccessTokenPublicKey)
+	if err != nil {
+		if payload.Prompt == "none" {
+			return authorizationRedirectError(c, payload, errors.ErrLoginRequired, "")
+		}
+
+		if env.OAuthLoginURL == "" {
+			return authorizationError(c, fiber.StatusUnauthorized, errors.ErrLoginRequired, "")
+		}
+
+		return c.Redirect(utils.WithQuery(env.OAuthLoginURL, url.Values{
+			"return_to": []string{c.BaseURL() + c.OriginalURL()},
+		}))
+	}
+
+	authorization := schemas.AuthorizationCode{
+		ClientID:      client.ClientID,
+		UserID:        tokenClaims.UserID,
+		RedirectURI:   payload.RedirectURI,
+		Scope:         scope,
+		CodeChallenge: payload.CodeChallenge,
+		Nonce:         payload.Nonce,
+		AuthTime:      tokenClaims.AuthTime,
+	}
+
+	granted, err := services.Consent{}.IsGranted(h, tokenClaims.UserID, client.ClientID, scope)
+	if err != nil {
+		log.Error(err, nil)
+		return authorizationRedirectError(c, payload, errors.ErrServerError, "")
+	}
+
+	// INFO: The user is only asked again when the client requests scopes that were not granted before
+	if !granted || payload.Prompt == "consent" {
+		if payload.Prompt == "none" {
+			return authorizationRedirectError(c, payload, errors.ErrConsentRequired, "")
+		}
+
+		challenge, err := utils.Authorization{}.CreateConsentChallenge(h, schemas.ConsentRequest{
+			Authorization: authorization,
+			State:         payload.State,
+		})
+		if err != nil {
+			log.Error(err, nil)
+			return authorizationRedirectError(c, payload, errors.ErrServerError, "")
+		}
+
+		if env.OAuthConsentURL == "" {
+			return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+				"status":            errors.ErrConsentRequired.Error(),
+				"consent_challenge": challenge,
+			})
+		}
+
+		return c.Redirect(utils.WithQuery(env.OAuthConsentURL, url.Values{
+			"consent_challenge": []string{challenge},
+		}))
+	}
+
+	redirectTo, err := authorizationRedirect(h, authorization, payload.State)
+	if err != nil {
+		log.Error(err, nil)
+		return authorizationRedirectError(c, payload, errors.ErrServerError, "")
+	}
+
+	return c.Redirect(redirectTo)
+}
+
+// GetConsent is a function that is used to get the details of the consent request so that the user
+// can be asked wether to allow the OAuth client to access the requested scopes
+func (Authorization) GetConsent(c *fiber.Ctx, h *initialize.H) error {
+	request, client, err := consentRequest(c, h)
+	if err != nil {
+		return consentError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"client_id":   client.ClientID,
+		"client_name": client.Name,
+		"scopes":      strings.Fields(request.Authorization.Scope),
+	})
+}
+
+// Consent is a function that is used to allow or deny the OAuth client to access the requested scopes,
+// the consent is remembered so that the user is not asked again, the client must be sent to redirect_to
+func (Authorization) Consent(c *fiber.Ctx, h *initialize.H) error {
+	var payload schemas.ConsentInput
+	if err := c.BodyParser(&payload); err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	request, client, err := consentRequest(c, h)
+	if err != nil {
+		return consentError(c, err)
+	}
+
+	err = utils.Authorization{}.DeleteConsentChallenge(h, c.Params("challenge"))
+	if err != nil {
+		return consentError(c, err)
+	}
+
+	if !payload.Approve {
+		params := url.Values{
+			"error": []string{errors.ErrAccessDenied.Error()},
+		}
+		if request.State != "" {
+			params.Set("state", request.State)
+		}
+
+		return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+			"redirect_to": utils.WithQuery(request.Authorization.RedirectURI, params),
+		})
+	}
+
+	err = services.Consent{}.Grant(h, request.Authorization.UserID, client.ClientID, request.Authorization.Scope)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	redirectTo, err := authorizationRedirect(h, request.Authorization, request.State)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"redirect_to": redirectTo,
+	})
+}
+
+// Token is a function that is used to issue the tokens to the OAuth clients in exchange for an
+// authorization code, a refresh token or an approved device code
+func (Authorization) Token(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	var payload schemas.TokenInput
+	if err := c.BodyParser(&payload); err != nil {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidRequest, "")
+	}
+
+	clientID, clientSecret, ok := clientCredentials(c, payload)
+	if !ok {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidRequest, "")
+	}
+
+	client, err := services.Client{}.Authenticate(h, clientID, clientSecret)
+	if err != nil {
+		if err == errors.ErrClientNotFound || err == errors.ErrInvalidClient {
+			return authorizationError(c, fiber.StatusUnauthorized, errors.ErrInvalidClient, "")
+		}
+
+		log.Error(err, nil)
+		return authorizationError(c, fiber.StatusInternalServerError, errors.ErrServerError, "")
+	}
+
+	if !(services.Client{}.IsGrantTypeAllowed(client, payload.GrantType)) {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrUnauthorizedClient, "")
+	}
+
+	var userID, scope, nonce string
+	var authTime int64
+	switch payload.GrantType {
+	case "authorization_code":
+		details, err := utils.Authorization{}.ExchangeCode(h, payload.Code)
+		if err != nil {
+			if err == errors.ErrInvalidGrant {
+				return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidGrant, "")
+			}
+
+			log.Error(err, nil)
+			return authorizationError(c, fiber.StatusInternalServerError, errors.ErrServerError, "")
+		}
+
+		if details.ClientID != client.ClientID || details.RedirectURI != payload.RedirectURI {
+			return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidGrant, "")
+		}
+		if !(utils.Authorization{}.VerifyCodeChallenge(payload.CodeVerifier, details.CodeChallenge)) {
+			return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidGrant, "code_verifier does not match the code_challenge")
+		}
+
+		userID, scope, nonce, authTime = details.UserID, details.Scope, details.Nonce, details.AuthTime
+	case "refresh_token":
+		tokenClaims, tokenValue, err := utils.Token{}.ValidateClientRefreshToken(h, payload.RefreshToken, env.RefreshTokenPublicKey, client.ClientID)
+		if err != nil {
+			return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidGrant, "")
+		}
+
+		scope = tokenValue.Scope
+		if payload.Scope != "" {
+			// INFO: The client can narrow down the scope but never widen it
+			granted := strings.Fields(tokenValue.Scope)
+			for _, s := range strings.Fields(payload.Scope) {
+				if !utils.Contains(granted, s) {
+					return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidScope, "")
+				}
+			}
+			scope = strings.Join(strings.Fields(payload.Scope), " ")
+		}
+
+		// INFO: Refresh tokens are rotated so a refresh token can only be used once
+		err = utils.Token{}.RotateToken(h, tokenClaims.TokenUUID, tokenValue.AccessTokenUUID)
+		if err != nil {
+			if err == errors.ErrUnauthorized {
+				return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidGrant, "")
+			}
+
+			log.Error(err, nil)
+			return authorizationError(c, fiber.StatusInternalServerError, errors.ErrServerError, "")
+		}
+
+		userID, authTime = tokenClaims.UserID, tokenValue.AuthTime
+	case services.DeviceCodeGrantType:
+		details, err := utils.Device{}.Poll(h, payload.DeviceCode, client.ClientID)
+		if err != nil {
+			switch err {
+			case errors.ErrAuthorizationPending, errors.ErrSlowDown, errors.ErrExpiredToken, errors.ErrAccessDenied, errors.ErrInvalidGrant:
+				return authorizationError(c, fiber.StatusBadRequest, err, "")
+			}
+
+			log.Error(err, nil)
+			return authorizationError(c, fiber.StatusInternalServerError, errors.ErrServerError, "")
+		}
+
+		userID, scope, authTime = details.UserID, details.Scope, details.AuthTime
+	default:
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrUnsupportedGrantType, "")
+	}
+
+	tokens, err := issueClientTokens(h, env, userID, client.ClientID, scope, nonce, authTime)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidGrant, "")
+		}
+
+		log.Error(err, nil)
+		return authorizationError(c, fiber.StatusInternalServerError, errors.ErrServerError, "")
+	}
+
+	return c.Status(fiber.StatusOK).JSON(tokens)
+}
+
+// OpenIDConfiguration is a function that is used to serve the OpenID Connect discovery document
+func (Authorization) OpenIDConfiguration(c *fiber.Ctx, env *config.Env) error {
+	issuer := strings.TrimSuffix(env.PublicURL, "/")
+
+	return c.Status(fiber.StatusOK).JSON(schemas.OpenIDConfiguration{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth/authorize",
+		TokenEndpoint:                     issuer + "/oauth/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JwksURI:                           issuer + "/.well-known/jwks.json",
+		RegistrationEndpoint:              issuer + "/oauth/register",
+		DeviceAuthorizationEndpoint:       issuer + "/oauth/device/code",
+		ScopesSupported:                   services.SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               services.SupportedGrantTypes,
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
+		TokenEndpointAuthMethodsSupported: services.SupportedTokenEndpointAuthMethods,
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "name", "preferred_username", "updated_at", "picture", "profile", "locale", "email", "email_verified"},
+	})
+}
+
+// JWKS is a function that is used to serve the public keys that the ID tokens are signed with
+func (Authorization) JWKS(c *fiber.Ctx, env *config.Env) error {
+	jwks, err := utils.Token{}.JWKS(env.AccessTokenPublicKey)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(jwks)
+}
+
+// UserInfo is a function that is used to get the claims of the user that the access token of the OAuth
+// client is allowed to read (OpenID Connect userinfo endpoint)
+func (Authorization) UserInfo(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		c.Set(fiber.HeaderWWWAuthenticate, "Bearer")
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	tokenClaims, err := utils.Token{}.ValidateClientAccessToken(h, strings.TrimPrefix(authorization, "Bearer "), env.AccessTokenPublicKey)
+	if err != nil {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if !utils.Contains(strings.Fields(tokenClaims.Scope), "openid") {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="openid"`)
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	var user models.User
+	if err := h.DB.DB.First(&user, "id = ?", tokenClaims.UserID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(schemas.FilterUserClaims(&user, tokenClaims.Scope))
+}
+
+// authorizationRedirect is a function that is used to create the authorization code and to get the URL
+// that the user must be sent back to the OAuth client with
+func authorizationRedirect(h *initialize.H, authorization schemas.AuthorizationCode, state string) (string, error) {
+	code, err := utils.Authorization{}.CreateCode(h, authorization)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{
+		"code": []string{code},
+	}
+	if state != "" {
+		params.Set("state", state)
+	}
+
+	return utils.WithQuery(authorization.RedirectURI, params), nil
+}
+
+// consentRequest is a function that is used to get the consent request of the logged in user along
+// with the OAuth client that it belongs to
+func consentRequest(c *fiber.Ctx, h *initialize.H) (*schemas.ConsentRequest, *models.OAuthClient, error) {
+	userID := c.Locals(config.Enums{}.USER()).(string)
+
+	request, err := utils.Authorization{}.GetConsentChallenge(h, c.Params("challenge"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// INFO: The consent can only be given by the user that started the authorization request
+	if request.Authorization.UserID != userID {
+		return nil, nil, errors.ErrConsentNotFound
+	}
+
+	client, err := services.Client{}.Get(h, request.Authorization.ClientID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return request, &client, nil
+}
+
+// consentError is a function that is used to respond to the errors of the consent requests
+func consentError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrConsentNotFound, errors.ErrClientNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: err.Error(),
+		})
+	default:
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+}
+
+// issueClientTokens is a function that is used to create the access and the refresh tokens of the OAuth client,
+// an ID token is created as well when the openid scope is granted
+func issueClientTokens(h *initialize.H, env *config.Env, userID, clientID, scope, nonce string, authTime int64) (*schemas.TokenResponse, error) {
+	var idToken string
+	if utils.Contains(strings.Fields(scope), "openid") {
+		var user models.User
+		if err := h.DB.DB.First(&user, "id = ?", userID).Error; err != nil {
+			return nil, err
+		}
+
+		var err error
+		idToken, err = utils.Token{}.CreateIDToken(
+			schemas.FilterUserClaims(&user, scope),
+			strings.TrimSuffix(env.PublicURL, "/"),
+			clientID,
+			nonce,
+			authTime,
+			env.AccessTokenPrivateKey,
+			env.AccessTokenExpires,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	accessTokenDetails, err := utils.Token{}.CreateClientAccessToken(h, userID, clientID, scope, env.AccessTokenPrivateKey, env.AccessTokenExpires)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshTokenDetails, err := utils.Token{}.CreateClientRefreshToken(h, userID, clientID, scope, accessTokenDetails.TokenUUID, env.RefreshTokenPrivateKey, env.RefreshTokenExpires, authTime)
+	if err != nil {
+		return nil, err
+	}
+
+	return &schemas.TokenResponse{
+		AccessToken:  *accessTokenDetails.Token,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(env.AccessTokenExpires.Seconds()),
+		RefreshToken: *refreshTokenDetails.Token,
+		Scope:        scope,
+		IDToken:      idToken,
+	}, nil
+}
+
+// clientCredentials is a function that is used to get the credentials of the OAuth client from the basic
+// authorization header (client_secret_basic) or from the body (client_secret_post)
+func clientCredentials(c *fiber.Ctx, payload schemas.TokenInput) (clientID, clientSecret string, ok bool) {
+	authorization := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(authorization, "Basic ") {
+		return payload.ClientID, payload.ClientSecret, payload.ClientID != ""
+	}
+
+	if payload.ClientSecret != "" {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authorization, "Basic "))
+	if err != nil {
+		return "", "", false
+	}
+
+	id, secret, found := strings.Cut(string(decoded), ":")
+	if !found {
+		return "", "", false
+	}
+
+	clientID, err = url.QueryUnescape(id)
+	if err != nil {
+		return "", "", false
+	}
+	clientSecret, err = url.QueryUnescape(secret)
+	if err != nil {
+		return "", "", false
+	}
+
+	if payload.ClientID != "" && payload.ClientID != clientID {
+		return "", "", false
+	}
+
+	return clientID, clientSecret, clientID != ""
+}
+
+// authorizationError is a function that is used to respond to the OAuth client with an error
+func authorizationError(c *fiber.Ctx, status int, err error, description string) error {
+	return c.Status(status).JSON(schemas.OAuthError{
+		Error:            err.Error(),
+		ErrorDescription: description,
+	})
+}
+
+// authorizationRedirectError is a function that is used to send the error of the authorization request
+// back to the OAuth client, only used once the redirect URI is validated
+func authorizationRedirectError(c *fiber.Ctx, payload schemas.AuthorizeInput, err error, description string) error {
+	params := url.Values{
+		"error": []string{err.Error()},
+	}
+	if description != "" {
+		params.Set("error_description", description)
+	}
+	if payload.State != "" {
+		params.Set("state", payload.State)
+	}
+
+	return c.Redirect(utils.WithQuery(payload.RedirectURI, params))
+}
@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/services"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Client contains the controllers that are used to register and manage the OAuth clients
+type Client struct{}
+
+// Register is a function that is used to register an OAuth client (dynamic client registration RFC 7591),
+// the client is pending until an admin approves it
+func (Client) Register(c *fiber.Ctx, h *initialize.H) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	var payload schemas.ClientMetadataInput
+	if err := c.BodyParser(&payload); err != nil {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidClientMetadata, "")
+	}
+
+	client, secret, err := services.Client{}.Register(h, payload)
+	if err != nil {
+		if err == errors.ErrInvalidRedirectURI || err == errors.ErrInvalidClientMetadata {
+			return authorizationError(c, fiber.StatusBadRequest, err, "")
+		}
+
+		log.Error(err, nil)
+		return authorizationError(c, fiber.StatusInternalServerError, errors.ErrServerError, "")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(schemas.FilterClientRecord(&client, secret))
+}
+
+// List is a function that is used to list all the OAuth clients
+func (Client) List(c *fiber.Ctx, h *initialize.H) error {
+	clients, err := services.Client{}.List(h)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"clients": schemas.FilterClientRecords(clients),
+	})
+}
+
+// Update is a function that is used to update the metadata of the OAuth client
+func (Client) Update(c *fiber.Ctx, h *initialize.H) error {
+	var payload schemas.ClientMetadataInput
+	if err := c.BodyParser(&payload); err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	client, err := services.Client{}.Update(h, c.Params("client_id"), payload)
+	if err != nil {
+		return clientError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"client": schemas.FilterClientRecord(&client, ""),
+	})
+}
+
+// Approve is a function that is used to approve the OAuth client that was registered dynamically
+func (Client) Approve(c *fiber.Ctx, h *initialize.H) error {
+	client, err := services.Client{}.Approve(h, c.Params("client_id"))
+	if err != nil {
+		return clientError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"client": schemas.FilterClientRecord(&client, ""),
+	})
+}
+
+// RotateSecret is a function that is used to issue a new secret to the OAuth client, the old secret
+// stops working immediately
+func (Client) RotateSecret(c *fiber.Ctx, h *initialize.H) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	client, secret, err := services.Client{}.RotateSecret(h, c.Params("client_id"))
+	if err != nil {
+		return clientError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"client": schemas.FilterClientRecord(&client, secret),
+	})
+}
+
+// Delete is a function that is used to delete the OAuth client along with the tokens that were issued to it
+func (Client) Delete(c *fiber.Ctx, h *initialize.H) error {
+	clientID := c.Params("client_id")
+
+	err := services.Client{}.Delete(h, clientID)
+	if err != nil {
+		return clientError(c, err)
+	}
+
+	err = utils.Token{}.DeleteClientTokens(h, clientID, "")
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
+// clientError is a function that is used to respond to the errors of managing the OAuth clients
+func clientError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrClientNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: err.Error(),
+		})
+	case errors.ErrInvalidRedirectURI, errors.ErrInvalidClientMetadata:
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: err.Error(),
+		})
+	default:
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+}
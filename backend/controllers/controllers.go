@@ -2,10 +2,77 @@
 package controllers
 
 import (
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/initialize"
 	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/utils"
 	"github.com/VinukaThejana/go-utils/logger"
+	"github.com/gofiber/fiber/v2"
 )
 
 var log logger.Logger
 
 type response schemas.Response
+
+// createSession is a function that is used to create the access and the refresh tokens for the
+// given user and to set them as cookies, a new session is treated as recently authenticated
+func createSession(c *fiber.Ctx, h *initialize.H, env *config.Env, userID string) error {
+	go func() {
+		utils.Token{}.DeleteExpiredTokens(h, userID)
+	}()
+
+	accessTokenDetails, err := utils.Token{}.CreateAccessToken(h, userID, env.AccessTokenPrivateKey, env.AccessTokenExpires, 0)
+	if err != nil {
+		return err
+	}
+
+	refreshTokenDetails, err := utils.Token{}.CreateRefreshToken(h, userID, env.RefreshTokenPrivateKey, env.RefreshTokenExpires, struct {
+		IPAddress       string
+		Location        string
+		Device          string
+		OS              string
+		AccessTokenUUID string
+	}{
+		AccessTokenUUID: accessTokenDetails.TokenUUID,
+	})
+	if err != nil {
+		return err
+	}
+
+	err = utils.Token{}.SetActionConfirmed(h, accessTokenDetails.TokenUUID)
+	if err != nil {
+		return err
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "access_token",
+		Value:    *accessTokenDetails.Token,
+		Path:     "/",
+		MaxAge:   env.AccessTokenMaxAge * 60,
+		Secure:   false,
+		HTTPOnly: true,
+		Domain:   "localhost",
+	})
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    *refreshTokenDetails.Token,
+		Path:     "/",
+		MaxAge:   env.RefreshTokenMaxAge * 60,
+		Secure:   false,
+		HTTPOnly: true,
+		Domain:   "localhost",
+	})
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "logged_in",
+		Value:    "true",
+		Path:     "/",
+		MaxAge:   env.AccessTokenMaxAge * 60,
+		Secure:   false,
+		HTTPOnly: false,
+		Domain:   "localhost",
+	})
+
+	return nil
+}
@@ -0,0 +1,150 @@
+package controllers
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/services"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Device contains the controllers of the device authorization grant (RFC 8628) that lets the command line
+// tools and the TVs log the users in with a user code that is approved on another device
+type Device struct{}
+
+// Code is a function that is used to start the device authorization request of the OAuth client, the user
+// must enter the returned user code at the verification URI while the client polls the token endpoint
+func (Device) Code(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	var payload schemas.TokenInput
+	if err := c.BodyParser(&payload); err != nil {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidRequest, "")
+	}
+
+	clientID, clientSecret, ok := clientCredentials(c, payload)
+	if !ok {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidRequest, "")
+	}
+
+	client, err := services.Client{}.Authenticate(h, clientID, clientSecret)
+	if err != nil {
+		if err == errors.ErrClientNotFound || err == errors.ErrInvalidClient {
+			return authorizationError(c, fiber.StatusUnauthorized, errors.ErrInvalidClient, "")
+		}
+
+		log.Error(err, nil)
+		return authorizationError(c, fiber.StatusInternalServerError, errors.ErrServerError, "")
+	}
+
+	if !(services.Client{}.IsGrantTypeAllowed(client, services.DeviceCodeGrantType)) {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrUnauthorizedClient, "")
+	}
+
+	scope, err := services.Client{}.AllowedScope(client, payload.Scope)
+	if err != nil {
+		return authorizationError(c, fiber.StatusBadRequest, errors.ErrInvalidScope, "")
+	}
+
+	deviceCode, userCode, err := utils.Device{}.CreateCode(h, client.ClientID, scope)
+	if err != nil {
+		log.Error(err, nil)
+		return authorizationError(c, fiber.StatusInternalServerError, errors.ErrServerError, "")
+	}
+
+	verificationURI := env.OAuthDeviceURL
+	if verificationURI == "" {
+		verificationURI = strings.TrimSuffix(env.PublicURL, "/") + "/oauth/device/verify"
+	}
+
+	return c.Status(fiber.StatusOK).JSON(schemas.DeviceCodeResponse{
+		DeviceCode:      deviceCode,
+		UserCode:        userCode,
+		VerificationURI: verificationURI,
+		VerificationURIComplete: utils.WithQuery(verificationURI, url.Values{
+			"user_code": []string{userCode},
+		}),
+		ExpiresIn: int64(utils.DeviceCodeExpirationTime.Seconds()),
+		Interval:  utils.DevicePollingInterval,
+	})
+}
+
+// GetVerification is a function that is used to get the details of the device authorization request that
+// the user code refers to so that the logged in user can be asked wether to allow the device
+func (Device) GetVerification(c *fiber.Ctx, h *initialize.H) error {
+	details, err := utils.Device{}.GetByUserCode(h, c.Query("user_code"))
+	if err != nil {
+		return deviceError(c, err)
+	}
+
+	client, err := services.Client{}.Get(h, details.ClientID)
+	if err != nil {
+		return deviceError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"client_id":   client.ClientID,
+		"client_name": client.Name,
+		"scopes":      strings.Fields(details.Scope),
+	})
+}
+
+// Verify is a function that is used to allow or deny the device that shows the user code to act on behalf
+// of the logged in user, the consent is remembered in the same way as the authorization code grant
+func (Device) Verify(c *fiber.Ctx, h *initialize.H) error {
+	var payload schemas.DeviceVerifyInput
+	if err := c.BodyParser(&payload); err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	if ok := log.Validate(payload); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	userID := c.Locals(config.Enums{}.USER()).(string)
+	authTime := c.Locals(config.Enums{}.AUTHTIME()).(int64)
+
+	details, err := utils.Device{}.Decide(h, payload.UserCode, userID, authTime, payload.Approve)
+	if err != nil {
+		return deviceError(c, err)
+	}
+
+	if payload.Approve {
+		err = services.Consent{}.Grant(h, userID, details.ClientID, details.Scope)
+		if err != nil {
+			log.Error(err, nil)
+			return c.Status(fiber.StatusInternalServerError).JSON(response{
+				Status: errors.ErrInternalServerError.Error(),
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
+// deviceError is a function that is used to respond to the errors of the device verification requests
+func deviceError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrInvalidUserCode, errors.ErrExpiredToken, errors.ErrClientNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: errors.ErrInvalidUserCode.Error(),
+		})
+	default:
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"github.com/VinukaThejana/auth/backend/config"
 	"github.com/VinukaThejana/auth/backend/errors"
 	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/schemas"
 	"github.com/VinukaThejana/auth/backend/utils"
 	"github.com/gofiber/fiber/v2"
 )
@@ -44,6 +45,48 @@ func (Email) ConfirmEmail(c *fiber.Ctx, h *initialize.H, env *config.Env) error
 	})
 }
 
+// ConfirmEmailWithCode is a function that is used to confirm the email address with the code of the
+// confirmation email, for the clients that can not follow the link
+func (Email) ConfirmEmailWithCode(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	var payload *schemas.EmailCodeInput
+	if err := c.BodyParser(&payload); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	if err := payload.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	userID := c.Locals(config.Enums{}.USER()).(string)
+
+	err := utils.Email{}.ConfirmEmailWithCode(h, env, payload.Code, userID)
+	if err != nil {
+		switch err {
+		case errors.ErrInvalidOTP, errors.ErrOTPExpired:
+			return c.Status(fiber.StatusBadRequest).JSON(response{
+				Status: err.Error(),
+			})
+		case errors.ErrUnauthorized:
+			return c.Status(fiber.StatusUnauthorized).JSON(response{
+				Status: err.Error(),
+			})
+		default:
+			log.Error(err, nil)
+			return c.Status(fiber.StatusInternalServerError).JSON(response{
+				Status: errors.ErrInternalServerError.Error(),
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
 // ResendEmailConfirmation is a function that is used to resend the email confirmation to the user
 func (Email) ResendEmailConfirmation(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 	userID := c.Locals(config.Enums{}.USER()).(string)
@@ -55,6 +98,11 @@ func (Email) ResendEmailConfirmation(c *fiber.Ctx, h *initialize.H, env *config.
 				Status: err.Error(),
 			})
 		}
+		if err == errors.ErrTooManyRequests {
+			return c.Status(fiber.StatusTooManyRequests).JSON(response{
+				Status: err.Error(),
+			})
+		}
 
 		log.Error(err, nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(response{
@@ -0,0 +1,45 @@
+package controllers
+
+import (
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/services"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+)
+
+// Internal contains the controllers that are only used by our internal services
+type Internal struct{}
+
+// GetProviderToken is a function that is used to get a valid access token of the provider account
+// that is linked to the user so that the internal services can call the provider on behalf of the user
+func (Internal) GetProviderToken(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	userID := c.Params("user_id")
+	if _, err := uuid.Parse(userID); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	token, err := services.ProviderToken{}.Get(h, env, userID, c.Params("provider"))
+	if err != nil {
+		switch err {
+		case errors.ErrIdentityNotFound, errors.ErrProviderTokenNotFound:
+			return c.Status(fiber.StatusNotFound).JSON(response{
+				Status: err.Error(),
+			})
+		case errors.ErrProviderTokenExpired:
+			return c.Status(fiber.StatusConflict).JSON(response{
+				Status: err.Error(),
+			})
+		default:
+			log.Error(err, nil)
+			return c.Status(fiber.StatusBadGateway).JSON(response{
+				Status: errors.ErrInternalServerError.Error(),
+			})
+		}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(token)
+}
@@ -3,10 +3,13 @@ package controllers
 import (
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/VinukaThejana/auth/backend/config"
 	"github.com/VinukaThejana/auth/backend/errors"
 	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
 	"github.com/VinukaThejana/auth/backend/services"
 	"github.com/VinukaThejana/auth/backend/utils"
 	"github.com/gofiber/fiber/v2"
@@ -16,76 +19,307 @@ import (
 type OAuth struct{}
 
 // RedirectToGitHubOAuthFlow controller redirects to the github oauth login page
-func (OAuth) RedirectToGitHubOAuthFlow(c *fiber.Ctx, env *config.Env) error {
-	options := url.Values{
-		"client_id":    []string{env.GithubClientID},
-		"redirect_uri": []string{env.GithubRedirectURL},
-		"scope":        []string{"user:email"},
-		"state":        []string{env.GithubFromURL},
+func (OAuth) RedirectToGitHubOAuthFlow(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	redirectURL, err := oauthRedirectURL(c, h, env, models.GitHubProvider, "")
+	if err != nil {
+		return oauthFlowError(c, err)
 	}
 
-	githubRedirectURL := fmt.Sprintf("%s?%s", env.GithubRootURL, options.Encode())
-	return c.Redirect(githubRedirectURL)
+	return c.Redirect(redirectURL)
 }
 
 // GithubOAuthCallback is a function that is used to continue the flow with github once the user
 // authorized the Github account
 func (OAuth) GithubOAuthCallback(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	details, err := validateOAuthFlow(c, h, models.GitHubProvider, c.Query("state"))
+	if err != nil {
+		return oauthStateError(c, env, err)
+	}
+
 	code := c.Query("code")
-	// state := c.Query("state")
+	if code == "" {
+		return oauthCallbackError(c, env, details, fiber.StatusUnauthorized, errors.ErrAccessDenied, nil)
+	}
+
+	accessToken, err := utils.OAuth{}.GetGitHubAccessToken(code, details.CodeVerifier, env)
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusBadGateway, errors.ErrProviderError, nil)
+	}
+
+	userDetails, err := utils.OAuth{}.GetGitHubUser(accessToken.AccessToken, env)
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusBadGateway, errors.ErrProviderError, nil)
+	}
 
+	if details.LinkUserID != "" {
+		return linkOAuthIdentity(c, h, env, details, userDetails.ToBasicOAuthProvider(), models.GitHubProvider, accessToken)
+	}
+
+	user, err := services.GitHub{}.GitHubOAuth(h, *userDetails)
+	if err != nil {
+		return oauthLoginError(c, h, env, details, err, userDetails.ToBasicOAuthProvider(), models.GitHubProvider)
+	}
+
+	storeProviderToken(h, env, models.GitHubProvider, userDetails.ToBasicOAuthProvider().ID, accessToken)
+
+	err = createSession(c, h, env, user.ID.String())
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	return completeOAuthFlow(c, env, details)
+}
+
+// RedirectToOIDCFlow controller redirects to the login page of the requested OIDC provider
+func (OAuth) RedirectToOIDCFlow(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	redirectURL, err := oauthRedirectURL(c, h, env, c.Params("provider"), "")
+	if err != nil {
+		return oauthFlowError(c, err)
+	}
+
+	return c.Redirect(redirectURL)
+}
+
+// OIDCCallback is a function that is used to continue the flow with the OIDC provider once the user
+// authorized the account
+func (OAuth) OIDCCallback(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	provider, ok := env.GetOIDCProvider(c.Params("provider"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: errors.ErrProviderNotFound.Error(),
+		})
+	}
+
+	details, err := validateOAuthFlow(c, h, provider.Name, c.Query("state"))
+	if err != nil {
+		return oauthStateError(c, env, err)
+	}
+
+	code := c.Query("code")
 	if code == "" {
-		return c.Status(fiber.StatusUnauthorized).JSON(response{
-			Status: errors.ErrUnauthorized.Error(),
+		return oauthCallbackError(c, env, details, fiber.StatusUnauthorized, errors.ErrAccessDenied, nil)
+	}
+
+	token, err := utils.OIDC{}.ExchangeCode(provider, code, details.CodeVerifier)
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusBadGateway, errors.ErrProviderError, nil)
+	}
+
+	profile, err := utils.OIDC{}.GetUser(provider, token, details.Nonce)
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusUnauthorized, errors.ErrUnauthorized, nil)
+	}
+
+	if details.LinkUserID != "" {
+		return linkOAuthIdentity(c, h, env, details, *profile, provider.Name, token)
+	}
+
+	user, err := services.OIDC{}.OIDCOAuth(h, *profile, provider.Name)
+	if err != nil {
+		return oauthLoginError(c, h, env, details, err, *profile, provider.Name)
+	}
+
+	storeProviderToken(h, env, provider.Name, profile.ID, token)
+
+	err = createSession(c, h, env, user.ID.String())
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	return completeOAuthFlow(c, env, details)
+}
+
+// RedirectToAppleOAuthFlow controller redirects to the Sign in with Apple page
+func (OAuth) RedirectToAppleOAuthFlow(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	redirectURL, err := oauthRedirectURL(c, h, env, models.AppleProvider, "")
+	if err != nil {
+		return oauthFlowError(c, err)
+	}
+
+	return c.Redirect(redirectURL)
+}
+
+// AppleOAuthCallback is a function that is used to continue the flow with Apple once the user
+// authorized the Apple account, Apple posts the result to this callback (form_post)
+func (OAuth) AppleOAuthCallback(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	if env.AppleClientID == "" {
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: errors.ErrProviderNotFound.Error(),
+		})
+	}
+
+	details, err := validateOAuthFlow(c, h, models.AppleProvider, c.FormValue("state"))
+	if err != nil {
+		return oauthStateError(c, env, err)
+	}
+
+	code := c.FormValue("code")
+	if code == "" {
+		return oauthCallbackError(c, env, details, fiber.StatusUnauthorized, errors.ErrAccessDenied, nil)
+	}
+
+	token, err := utils.OAuth{}.GetAppleToken(code, env)
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusBadGateway, errors.ErrProviderError, nil)
+	}
+
+	userDetails, err := utils.OAuth{}.GetAppleUser(token.IDToken, c.FormValue("user"), details.Nonce, env)
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusUnauthorized, errors.ErrUnauthorized, nil)
+	}
+
+	if details.LinkUserID != "" {
+		return linkOAuthIdentity(c, h, env, details, userDetails.ToBasicOAuthProvider(), models.AppleProvider, token)
+	}
+
+	user, err := services.Apple{}.AppleOAuth(h, *userDetails)
+	if err != nil {
+		return oauthLoginError(c, h, env, details, err, userDetails.ToBasicOAuthProvider(), models.AppleProvider)
+	}
+
+	storeProviderToken(h, env, models.AppleProvider, userDetails.ID, token)
+
+	err = createSession(c, h, env, user.ID.String())
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	return completeOAuthFlow(c, env, details)
+}
+
+// ConfirmAccountLink is a function that is used to link the provider account to the local account once
+// the owner of the email address confirmed it from the email, the user is logged in afterwards
+func (OAuth) ConfirmAccountLink(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	pending, err := utils.Email{}.ConfirmAccountLink(h, c.Query("token"))
+	if err != nil {
+		if err == errors.ErrBadRequest || err == errors.ErrAccountLinkExpired {
+			return oauthCallbackError(c, env, nil, fiber.StatusBadRequest, err, nil)
+		}
+
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, nil, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	user, err := services.Identity{}.ConfirmPendingLink(h, *pending)
+	if err != nil {
+		if err == errors.ErrAccountLinkExpired || err == errors.ErrIdentityAlreadyLinked {
+			return oauthCallbackError(c, env, nil, fiber.StatusBadRequest, err, nil)
+		}
+
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, nil, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	err = services.Audit{}.Record(h, user.ID.String(), models.AuditIdentityLinkedByEmail, pending.Provider, c.IP())
+	if err != nil {
+		log.Error(err, nil)
+	}
+
+	err = createSession(c, h, env, user.ID.String())
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, nil, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	return completeOAuthFlow(c, env, nil)
+}
+
+// CompleteSignup is a function that is used to register the user with the provider account that is
+// referred by the signup ticket once the user chose a username
+func (OAuth) CompleteSignup(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	var payload *schemas.CompleteSignupInput
+	if err := c.BodyParser(&payload); err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
 		})
 	}
 
-	accessToken, err := utils.OAuth{}.GetGitHubAccessToken(code, env)
+	if ok := log.Validate(payload); !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	ticketID, err := utils.Token{}.ValidateSignupTicket(h, c.Cookies("signup_ticket"), env.AccessTokenPublicKey)
 	if err != nil {
+		if err == errors.ErrSignupTicketExpired {
+			return c.Status(fiber.StatusUnauthorized).JSON(response{
+				Status: err.Error(),
+			})
+		}
+
 		log.Error(err, nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(response{
 			Status: errors.ErrInternalServerError.Error(),
 		})
 	}
 
-	userDetails, err := utils.OAuth{}.GetGitHubUser(*accessToken)
+	ok, err := services.User{}.IsUsernameAvailable(h, payload.Username)
 	if err != nil {
 		log.Error(err, nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(response{
 			Status: errors.ErrInternalServerError.Error(),
 		})
 	}
+	if !ok {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrUsernameAlreadyUsed.Error(),
+		})
+	}
 
-	fmt.Println(*userDetails, userDetails.ID)
-
-	user, err := services.GitHub{}.GitHubOAuth(h, *userDetails)
+	// INFO: The ticket is consumed before the user is created so that it can not be used twice
+	details, err := utils.Token{}.ConsumeSignupTicket(h, ticketID)
 	if err != nil {
+		if err == errors.ErrSignupTicketExpired {
+			return c.Status(fiber.StatusUnauthorized).JSON(response{
+				Status: err.Error(),
+			})
+		}
+
+		log.Error(err, nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(response{
 			Status: errors.ErrInternalServerError.Error(),
 		})
 	}
 
-	go func() {
-		utils.Token{}.DeleteExpiredTokens(h, user.ID.String())
-	}()
+	c.Cookie(&fiber.Cookie{
+		Name:    "signup_ticket",
+		Value:   "",
+		Path:    "/oauth/complete-signup",
+		Expires: time.Now().Add(-time.Hour * 24),
+	})
+
+	profile := details.Profile
+	profile.Username = payload.Username
+	if profile.Name == "" {
+		profile.Name = payload.Username
+	}
 
-	accessTokenDetails, err := utils.Token{}.CreateAccessToken(h, user.ID.String(), env.AccessTokenPrivateKey, env.AccessTokenExpires)
+	user, err := services.User{}.CreateWithProvider(h, profile, details.Provider)
 	if err != nil {
+		if ok := (errors.CheckDBError{}.DuplicateKey(err)); ok {
+			return c.Status(fiber.StatusBadRequest).JSON(response{
+				Status: errors.ErrBadRequest.Error(),
+			})
+		}
+
 		log.Error(err, nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(response{
 			Status: errors.ErrInternalServerError.Error(),
 		})
 	}
 
-	refreshTokenDetails, err := utils.Token{}.CreateRefreshToken(h, user.ID.String(), env.RefreshTokenPrivateKey, env.RefreshTokenExpires, struct {
-		IPAddress       string
-		Location        string
-		Device          string
-		OS              string
-		AccessTokenUUID string
-	}{
-		AccessTokenUUID: accessTokenDetails.TokenUUID,
-	})
+	err = createSession(c, h, env, user.ID.String())
 	if err != nil {
 		log.Error(err, nil)
 		return c.Status(fiber.StatusInternalServerError).JSON(response{
@@ -93,37 +327,268 @@ func (OAuth) GithubOAuthCallback(c *fiber.Ctx, h *initialize.H, env *config.Env)
 		})
 	}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "access_token",
-		Value:    *accessTokenDetails.Token,
-		Path:     "/",
-		MaxAge:   env.AccessTokenMaxAge * 60,
-		Secure:   false,
-		HTTPOnly: true,
-		Domain:   "localhost",
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
 	})
+}
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    *refreshTokenDetails.Token,
-		Path:     "/",
-		MaxAge:   env.RefreshTokenMaxAge * 60,
+// oauthRedirectURL is a function that is used to start the OAuth flow with the given provider and to
+// get the URL of the login page of the provider, the provider account is linked to the user with the
+// given linkUserID instead of logging in when it is not empty
+func oauthRedirectURL(c *fiber.Ctx, h *initialize.H, env *config.Env, provider, linkUserID string) (string, error) {
+	switch provider {
+	case models.GitHubProvider:
+		state, details, err := startOAuthFlow(c, h, env, provider, linkUserID, true)
+		if err != nil {
+			return "", err
+		}
+
+		options := url.Values{
+			"client_id":             []string{env.GithubClientID},
+			"redirect_uri":          []string{env.GithubRedirectURL},
+			"scope":                 []string{"user:email"},
+			"state":                 []string{state},
+			"code_challenge":        []string{utils.State{}.CodeChallenge(details.CodeVerifier)},
+			"code_challenge_method": []string{"S256"},
+		}
+
+		return fmt.Sprintf("%s?%s", env.GithubRootURL, options.Encode()), nil
+	case models.AppleProvider:
+		if env.AppleClientID == "" {
+			return "", errors.ErrProviderNotFound
+		}
+
+		// INFO: Apple does not support PKCE
+		state, details, err := startOAuthFlow(c, h, env, provider, linkUserID, false)
+		if err != nil {
+			return "", err
+		}
+
+		return utils.OAuth{}.GetAppleAuthCodeURL(state, details.Nonce, env), nil
+	default:
+		oidcProvider, ok := env.GetOIDCProvider(provider)
+		if !ok {
+			return "", errors.ErrProviderNotFound
+		}
+
+		pkce, err := utils.OIDC{}.SupportsPKCE(oidcProvider)
+		if err != nil {
+			return "", err
+		}
+
+		state, details, err := startOAuthFlow(c, h, env, provider, linkUserID, pkce)
+		if err != nil {
+			return "", err
+		}
+
+		return utils.OIDC{}.GetAuthCodeURL(oidcProvider, state, details)
+	}
+}
+
+// startOAuthFlow is a function that is used to create the state of the OAuth flow and to bind it to
+// the browser that started the flow with a cookie
+func startOAuthFlow(c *fiber.Ctx, h *initialize.H, env *config.Env, provider, linkUserID string, pkce bool) (string, *schemas.OAuthState, error) {
+	returnTo := c.Query("return_to")
+	if returnTo != "" && !(utils.State{}.IsReturnToAllowed(returnTo, env.OAuthReturnToAllowlist)) {
+		return "", nil, errors.ErrReturnToNotAllowed
+	}
+
+	state, binding, details, err := utils.State{}.Create(h, provider, returnTo, linkUserID, pkce)
+	if err != nil {
+		return "", nil, err
+	}
+
+	cookie := &fiber.Cookie{
+		Name:     "oauth_state",
+		Value:    binding,
+		Path:     "/oauth/sessions",
+		MaxAge:   10 * 60,
 		Secure:   false,
 		HTTPOnly: true,
-		Domain:   "localhost",
-	})
+		SameSite: fiber.CookieSameSiteLaxMode,
+	}
+	if _, saml := env.GetSAMLConnection(provider); saml || provider == models.AppleProvider {
+		// INFO: Apple and the SAML IdPs post the callback cross site (form_post, HTTP-POST binding) so the
+		// cookie must be sent on cross site requests
+		cookie.SameSite = fiber.CookieSameSiteNoneMode
+		cookie.Secure = true
+	}
+	c.Cookie(cookie)
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "logged_in",
-		Value:    "true",
-		Path:     "/",
-		MaxAge:   env.AccessTokenMaxAge * 60,
-		Secure:   false,
-		HTTPOnly: false,
-		Domain:   "localhost",
-	})
+	return state, details, nil
+}
+
+// validateOAuthFlow is a function that is used to validate the state that is returned by the provider
+// against the cookie that was set when the flow was started
+func validateOAuthFlow(c *fiber.Ctx, h *initialize.H, provider, state string) (*schemas.OAuthState, error) {
+	binding := c.Cookies("oauth_state")
+	c.ClearCookie("oauth_state")
+
+	return utils.State{}.Validate(h, state, binding, provider)
+}
+
+// completeOAuthFlow is a function that is used to send the user to the return_to URL or to the frontend
+// (OAUTH_COMPLETION_URL) once logged in
+func completeOAuthFlow(c *fiber.Ctx, env *config.Env, details *schemas.OAuthState) error {
+	if redirectTo := oauthCompletionURL(env, details); redirectTo != "" {
+		return c.Redirect(redirectTo)
+	}
 
 	return c.Status(fiber.StatusOK).JSON(response{
 		Status: errors.Okay,
 	})
 }
+
+// oauthCompletionURL is a function that is used to get the URL that the user is sent to at the end of the
+// OAuth flow, the return_to URL is already validated against the allowlist when the flow was started
+func oauthCompletionURL(env *config.Env, details *schemas.OAuthState) string {
+	if details != nil && details.ReturnTo != "" {
+		return details.ReturnTo
+	}
+
+	return env.OAuthCompletionURL
+}
+
+// oauthCallbackError is a function that is used to send the user back to the frontend with the machine
+// readable error code (and the given params) in the query string, the JSON response is used instead
+// when there is nowhere to send the user
+func oauthCallbackError(c *fiber.Ctx, env *config.Env, details *schemas.OAuthState, status int, err error, params url.Values) error {
+	redirectTo := oauthCompletionURL(env, details)
+	if redirectTo == "" {
+		payload := fiber.Map{
+			"status": err.Error(),
+		}
+		for key := range params {
+			payload[key] = params.Get(key)
+		}
+
+		return c.Status(status).JSON(payload)
+	}
+
+	if params == nil {
+		params = url.Values{}
+	}
+	params.Set("error", err.Error())
+
+	return c.Redirect(utils.WithQuery(redirectTo, params))
+}
+
+// oauthStateError is a function that is used to respond to the errors of validating the state of the
+// OAuth flow in the callbacks
+func oauthStateError(c *fiber.Ctx, env *config.Env, err error) error {
+	if err == errors.ErrInvalidState {
+		return oauthCallbackError(c, env, nil, fiber.StatusUnauthorized, err, nil)
+	}
+
+	log.Error(err, nil)
+	return oauthCallbackError(c, env, nil, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+}
+
+// linkOAuthIdentity is a function that is used to link the provider account to the logged in user
+// that started the flow
+func linkOAuthIdentity(c *fiber.Ctx, h *initialize.H, env *config.Env, details *schemas.OAuthState, profile schemas.BasicOAuthProvider, provider string, token *schemas.OAuthToken) error {
+	_, err := services.Identity{}.Link(h, details.LinkUserID, profile, provider)
+	if err != nil {
+		if err == errors.ErrIdentityAlreadyLinked || err == errors.ErrProviderAlreadyLinked {
+			return oauthCallbackError(c, env, details, fiber.StatusBadRequest, err, nil)
+		}
+
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	err = services.Audit{}.Record(h, details.LinkUserID, models.AuditIdentityLinked, provider, c.IP())
+	if err != nil {
+		log.Error(err, nil)
+	}
+
+	storeProviderToken(h, env, provider, profile.ID, token)
+
+	return completeOAuthFlow(c, env, details)
+}
+
+// storeProviderToken is a function that is used to save the tokens of the provider with the linked account
+// so that they can be used to call the provider on behalf of the user, failing to do so must not
+// prevent the user from logging in
+func storeProviderToken(h *initialize.H, env *config.Env, provider, providerID string, token *schemas.OAuthToken) {
+	err := services.ProviderToken{}.Store(h, env, provider, providerID, token)
+	if err != nil {
+		log.Error(err, nil)
+	}
+}
+
+// oauthLoginError is a function that is used to respond to the errors of logging in with the provider account
+func oauthLoginError(c *fiber.Ctx, h *initialize.H, env *config.Env, details *schemas.OAuthState, err error, profile schemas.BasicOAuthProvider, provider string) error {
+	switch err {
+	case errors.ErrConfirmAccountLink:
+		id, _, _, err := services.User{}.IsEmailAvailable(h, *profile.Email)
+		if err != nil || id == nil {
+			log.Error(err, nil)
+			return oauthCallbackError(c, env, details, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+		}
+
+		err = utils.Email{}.SendAccountLinkConfirmation(h, env, schemas.PendingLink{
+			UserID:   id.String(),
+			Email:    *profile.Email,
+			Provider: provider,
+			Profile:  profile,
+		})
+		if err != nil {
+			log.Error(err, nil)
+			return oauthCallbackError(c, env, details, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+		}
+
+		return oauthCallbackError(c, env, details, fiber.StatusAccepted, errors.ErrConfirmAccountLink, nil)
+	case errors.ErrAddAUsername:
+		ticket, err := utils.Token{}.CreateSignupTicket(h, schemas.SignupTicket{
+			Provider: provider,
+			Profile:  profile,
+		}, env.AccessTokenPrivateKey)
+		if err != nil {
+			log.Error(err, nil)
+			return oauthCallbackError(c, env, details, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+		}
+
+		// INFO: The ticket is kept out of the URL (browser history, logs, Referer) and is sent back by the
+		// browser when the frontend completes the signup once the user chose a username
+		c.Cookie(&fiber.Cookie{
+			Name:     "signup_ticket",
+			Value:    ticket,
+			Path:     "/oauth/complete-signup",
+			MaxAge:   int(utils.SignupTicketExpirationTime.Seconds()),
+			Secure:   false,
+			HTTPOnly: true,
+			SameSite: fiber.CookieSameSiteLaxMode,
+		})
+
+		return oauthCallbackError(c, env, details, fiber.StatusAccepted, errors.ErrAddAUsername, nil)
+	case errors.ErrHaveAnAccountWithTheEmail:
+		return oauthCallbackError(c, env, details, fiber.StatusBadRequest, errors.ErrEmailConflict, nil)
+	default:
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+}
+
+// oauthFlowError is a function that is used to respond to the errors of the OAuth state
+func oauthFlowError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrInvalidState:
+		return c.Status(fiber.StatusUnauthorized).JSON(response{
+			Status: err.Error(),
+		})
+	case errors.ErrProviderNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: err.Error(),
+		})
+	case errors.ErrReturnToNotAllowed:
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: err.Error(),
+		})
+	default:
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+}
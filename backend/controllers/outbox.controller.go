@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// Outbox contains the controllers that are used by the admins to inspect the emails of the outbox and to
+// retry the dead emails
+type Outbox struct{}
+
+// List is a function that is used to list the latest emails of the outbox, ?status=dead lists the dead emails
+func (Outbox) List(c *fiber.Ctx, h *initialize.H) error {
+	status := c.Query("status")
+	if status != "" && status != models.OutboxPending && status != models.OutboxSent && status != models.OutboxDead {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	limit := c.QueryInt("limit", 50)
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	emails, err := utils.Outbox{}.List(h, status, limit)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"emails": schemas.FilterOutboxEmailRecords(emails),
+	})
+}
+
+// Get is a function that is used to get the email of the outbox along with the attempts to deliver it
+func (Outbox) Get(c *fiber.Ctx, h *initialize.H) error {
+	email, err := utils.Outbox{}.Get(h, c.Params("id"))
+	if err != nil {
+		return outboxError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"email": schemas.FilterOutboxEmailRecord(&email),
+	})
+}
+
+// Retry is a function that is used to move the dead email back to the outbox to be sent again
+func (Outbox) Retry(c *fiber.Ctx, h *initialize.H) error {
+	email, err := utils.Outbox{}.Retry(h, c.Params("id"))
+	if err != nil {
+		return outboxError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"email": schemas.FilterOutboxEmailRecord(&email),
+	})
+}
+
+// outboxError is a function that is used to respond to the errors of managing the outbox
+func outboxError(c *fiber.Ctx, err error) error {
+	switch err {
+	case errors.ErrEmailNotFound:
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: err.Error(),
+		})
+	case errors.ErrEmailNotDead, errors.ErrEmailExpired:
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: err.Error(),
+		})
+	default:
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+}
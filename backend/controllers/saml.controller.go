@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/services"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+// SAML contains the controllers of the SAML 2.0 service provider that logs the users in with the
+// identity providers of the enterprise customers
+type SAML struct{}
+
+// Metadata is a function that is used to serve the SP metadata of the connection that must be registered
+// with the IdP
+func (SAML) Metadata(c *fiber.Ctx, env *config.Env) error {
+	connection, ok := env.GetSAMLConnection(c.Params("connection"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: errors.ErrProviderNotFound.Error(),
+		})
+	}
+
+	metadata, err := utils.SAML{}.GetMetadata(connection)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/samlmetadata+xml")
+	return c.Status(fiber.StatusOK).Send(metadata)
+}
+
+// RedirectToSAMLFlow controller redirects to the login page of the IdP of the requested connection
+func (SAML) RedirectToSAMLFlow(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	connection, ok := env.GetSAMLConnection(c.Params("connection"))
+	if !ok {
+		return oauthFlowError(c, errors.ErrProviderNotFound)
+	}
+
+	state, details, err := startOAuthFlow(c, h, env, connection.Name, "", false)
+	if err != nil {
+		return oauthFlowError(c, err)
+	}
+
+	redirectURL, err := utils.SAML{}.GetAuthnRequestURL(connection, utils.SAML{}.RequestID(details), state)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Redirect(redirectURL)
+}
+
+// SAMLCallback is a function that is used to log the user in with the response that the IdP posts to the
+// ACS URL, only the responses to the authentication requests that were started by the same browser
+// are accepted (IdP initiated logins are not supported)
+func (SAML) SAMLCallback(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	connection, ok := env.GetSAMLConnection(c.Params("connection"))
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: errors.ErrProviderNotFound.Error(),
+		})
+	}
+
+	details, err := validateOAuthFlow(c, h, connection.Name, c.FormValue("RelayState"))
+	if err != nil {
+		return oauthStateError(c, env, err)
+	}
+
+	profile, err := utils.SAML{}.ParseResponse(connection, c.FormValue("SAMLResponse"), utils.SAML{}.RequestID(details))
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusUnauthorized, errors.ErrInvalidSAMLResponse, nil)
+	}
+
+	user, err := services.SAML{}.SAMLLogin(h, *profile, connection.Name)
+	if err != nil {
+		return oauthLoginError(c, h, env, details, err, *profile, connection.Name)
+	}
+
+	err = createSession(c, h, env, user.ID.String())
+	if err != nil {
+		log.Error(err, nil)
+		return oauthCallbackError(c, env, details, fiber.StatusInternalServerError, errors.ErrInternalServerError, nil)
+	}
+
+	return completeOAuthFlow(c, env, details)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/VinukaThejana/auth/backend/initialize"
 	"github.com/VinukaThejana/auth/backend/models"
 	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/services"
 	"github.com/VinukaThejana/auth/backend/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -93,7 +94,10 @@ func (User) UpdateEmail(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 		})
 	}
 
-	go utils.Email{}.SendConfirmation(h, env, payload.Email, userID.String())
+	err = utils.Email{}.SendConfirmation(h, env, payload.Email, userID.String())
+	if err != nil {
+		log.Error(err, nil)
+	}
 
 	return c.Status(fiber.StatusOK).JSON(response{
 		Status: errors.Okay,
@@ -191,6 +195,43 @@ func (User) UpdateName(c *fiber.Ctx, h *initialize.H) error {
 	})
 }
 
+// UpdateProfile is a function that is used to set the profile attributes (avatar URL, profile URL and
+// locale) of the user instead of the ones that are sent by the providers
+func (User) UpdateProfile(c *fiber.Ctx, h *initialize.H) error {
+	var payload schemas.UpdateProfileInput
+	if err := c.BodyParser(&payload); err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	if err := payload.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(response{
+			Status: errors.ErrBadRequest.Error(),
+		})
+	}
+
+	userID := c.Locals(config.Enums{}.USER()).(string)
+	err := services.User{}.UpdateProfile(h, userID, payload)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusUnauthorized).JSON(response{
+				Status: errors.ErrUnauthorized.Error(),
+			})
+		}
+
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
 // GetAuthInstances is a function that is used to obtain the authed instances of the user
 func (User) GetAuthInstances(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 	refreshToken := c.Cookies("refresh_token")
@@ -340,6 +381,12 @@ func (User) ConfirmAction(c *fiber.Ctx, h *initialize.H, env *config.Env) error
 		}
 	}
 
+	if user.ID.String() != c.Locals(config.Enums{}.USER()).(string) {
+		return c.Status(fiber.StatusUnauthorized).JSON(response{
+			Status: errors.ErrUnauthorized.Error(),
+		})
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(payload.Password))
 	if err != nil {
 		log.Error(err, nil)
@@ -348,6 +395,134 @@ func (User) ConfirmAction(c *fiber.Ctx, h *initialize.H, env *config.Env) error
 		})
 	}
 
+	err = utils.Token{}.SetActionConfirmed(h, c.Locals(config.Enums{}.ACCESSTOKENUUID()).(string))
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
+// GetIdentities is a function that is used to get the provider accounts that are linked to the user
+func (User) GetIdentities(c *fiber.Ctx, h *initialize.H) error {
+	userID := c.Locals(config.Enums{}.USER()).(string)
+
+	identities, err := services.Identity{}.List(h, userID)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"identities": schemas.FilterIdentityRecords(identities),
+	})
+}
+
+// LinkIdentity is a function that is used to start the OAuth flow to link another provider account to
+// the logged in user, the client must send the browser to the returned URL
+func (User) LinkIdentity(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	userID := c.Locals(config.Enums{}.USER()).(string)
+
+	redirectURL, err := oauthRedirectURL(c, h, env, c.Params("provider"), userID)
+	if err != nil {
+		return oauthFlowError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"url": redirectURL,
+	})
+}
+
+// UnlinkIdentity is a function that is used to unlink a provider account from the user, the session must
+// be recently authenticated (ConfirmAction or a new login)
+func (User) UnlinkIdentity(c *fiber.Ctx, h *initialize.H) error {
+	userID := c.Locals(config.Enums{}.USER()).(string)
+	accessTokenUUID := c.Locals(config.Enums{}.ACCESSTOKENUUID()).(string)
+	provider := c.Params("provider")
+
+	if ok := (utils.Token{}.IsActionConfirmed(h, accessTokenUUID)); !ok {
+		return c.Status(fiber.StatusForbidden).JSON(response{
+			Status: errors.ErrConfirmationRequired.Error(),
+		})
+	}
+
+	err := services.Identity{}.Unlink(h, userID, provider)
+	if err != nil {
+		switch err {
+		case errors.ErrIdentityNotFound:
+			return c.Status(fiber.StatusNotFound).JSON(response{
+				Status: err.Error(),
+			})
+		case errors.ErrLastSignInMethod, errors.ErrDirectoryIdentity:
+			return c.Status(fiber.StatusBadRequest).JSON(response{
+				Status: err.Error(),
+			})
+		case errors.ErrUnauthorized:
+			return c.Status(fiber.StatusUnauthorized).JSON(response{
+				Status: err.Error(),
+			})
+		default:
+			log.Error(err, nil)
+			return c.Status(fiber.StatusInternalServerError).JSON(response{
+				Status: errors.ErrInternalServerError.Error(),
+			})
+		}
+	}
+
+	err = services.Audit{}.Record(h, userID, models.AuditIdentityUnlinked, provider, c.IP())
+	if err != nil {
+		log.Error(err, nil)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response{
+		Status: errors.Okay,
+	})
+}
+
+// GetConsents is a function that is used to get the OAuth clients that the user allowed to access the account
+func (User) GetConsents(c *fiber.Ctx, h *initialize.H) error {
+	userID := c.Locals(config.Enums{}.USER()).(string)
+
+	consents, err := services.Consent{}.List(h, userID)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(&fiber.Map{
+		"consents": schemas.FilterConsentRecords(consents),
+	})
+}
+
+// RevokeConsent is a function that is used to revoke the tokens that were issued to the OAuth client on
+// behalf of the user and to remove the consent that the user gave to the client
+func (User) RevokeConsent(c *fiber.Ctx, h *initialize.H) error {
+	userID := c.Locals(config.Enums{}.USER()).(string)
+	clientID := c.Params("client_id")
+
+	err := services.Consent{}.Revoke(h, userID, clientID)
+	if err != nil {
+		if err == errors.ErrConsentNotFound {
+			return c.Status(fiber.StatusNotFound).JSON(response{
+				Status: err.Error(),
+			})
+		}
+
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
 	return c.Status(fiber.StatusOK).JSON(response{
 		Status: errors.Okay,
 	})
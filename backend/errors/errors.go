@@ -14,6 +14,7 @@ var (
 	ErrUnauthorized              = fmt.Errorf("unauthorized")
 	ErrAccessTokenNotProvided    = fmt.Errorf("access_token_not_provided")
 	ErrBadRequest                = fmt.Errorf("bad_request")
+	ErrNotFound                  = fmt.Errorf("not_found")
 	ErrIncorrectCredentials      = fmt.Errorf("incorrect_credentials")
 	ErrRefreshTokenExpired       = fmt.Errorf("refresh_token_expired")
 	ErrAccessTokenExpired        = fmt.Errorf("access_token_expired")
@@ -22,11 +23,66 @@ var (
 	ErrEmailConfirmationExpired  = fmt.Errorf("email_confirmation_expired")
 	ErrHaveAnAccountWithTheEmail = fmt.Errorf("already_have_an_account")
 	ErrAddAUsername              = fmt.Errorf("add_a_username")
+	ErrProviderNotFound          = fmt.Errorf("provider_not_found")
+	ErrInvalidState              = fmt.Errorf("invalid_state")
+	ErrReturnToNotAllowed        = fmt.Errorf("return_to_not_allowed")
+	ErrIdentityAlreadyLinked     = fmt.Errorf("identity_already_linked")
+	ErrProviderAlreadyLinked     = fmt.Errorf("provider_already_linked")
+	ErrIdentityNotFound          = fmt.Errorf("identity_not_found")
+	ErrLastSignInMethod          = fmt.Errorf("last_sign_in_method")
+	ErrDirectoryIdentity         = fmt.Errorf("directory_identity")
+	ErrConfirmationRequired      = fmt.Errorf("confirmation_required")
+	ErrConfirmAccountLink        = fmt.Errorf("confirm_account_link")
+	ErrAccountLinkExpired        = fmt.Errorf("account_link_expired")
+	ErrSignupTicketExpired       = fmt.Errorf("signup_ticket_expired")
+	ErrProviderTokenNotFound     = fmt.Errorf("provider_token_not_found")
+	ErrProviderTokenExpired      = fmt.Errorf("provider_token_expired")
+	ErrClientNotFound            = fmt.Errorf("client_not_found")
+	ErrInvalidRedirectURI        = fmt.Errorf("invalid_redirect_uri")
+	ErrInvalidClientMetadata     = fmt.Errorf("invalid_client_metadata")
+	ErrForbidden                 = fmt.Errorf("forbidden")
+	ErrConsentNotFound           = fmt.Errorf("consent_not_found")
+	ErrInvalidUserCode           = fmt.Errorf("invalid_user_code")
+	ErrInvalidSAMLResponse       = fmt.Errorf("invalid_saml_response")
+	ErrDirectoryUserNotFound     = fmt.Errorf("directory_user_not_found")
+	ErrEmailConflict             = fmt.Errorf("email_conflict")
+	ErrProviderError             = fmt.Errorf("provider_error")
+	ErrEmailNotFound             = fmt.Errorf("email_not_found")
+	ErrEmailNotDead              = fmt.Errorf("email_not_dead")
+	ErrEmailExpired              = fmt.Errorf("email_expired")
+	ErrPasswordResetExpired      = fmt.Errorf("password_reset_expired")
+	ErrMagicLinkExpired          = fmt.Errorf("magic_link_expired")
+	ErrMagicLinkBrowserMismatch  = fmt.Errorf("magic_link_browser_mismatch")
+	ErrTooManyRequests           = fmt.Errorf("too_many_requests")
+	ErrInvalidOTP                = fmt.Errorf("invalid_code")
+	ErrOTPExpired                = fmt.Errorf("code_expired")
 	Okay                         = "okay"
 
 //revive:enable
 )
 
+// The errors that are returned to the OAuth clients (RFC 6749)
+var (
+	//revive:disable
+	ErrInvalidRequest          = fmt.Errorf("invalid_request")
+	ErrInvalidClient           = fmt.Errorf("invalid_client")
+	ErrInvalidGrant            = fmt.Errorf("invalid_grant")
+	ErrUnauthorizedClient      = fmt.Errorf("unauthorized_client")
+	ErrUnsupportedGrantType    = fmt.Errorf("unsupported_grant_type")
+	ErrUnsupportedResponseType = fmt.Errorf("unsupported_response_type")
+	ErrInvalidScope            = fmt.Errorf("invalid_scope")
+	ErrAccessDenied            = fmt.Errorf("access_denied")
+	ErrLoginRequired           = fmt.Errorf("login_required")
+	ErrConsentRequired         = fmt.Errorf("consent_required")
+	ErrAuthorizationPending    = fmt.Errorf("authorization_pending")
+	ErrSlowDown                = fmt.Errorf("slow_down")
+	ErrExpiredToken            = fmt.Errorf("expired_token")
+	ErrServerError             = fmt.Errorf("server_error")
+	ErrInvalidToken            = fmt.Errorf("invalid_token")
+
+//revive:enable
+)
+
 // CheckDBError is a struc that is used to identify the database errors
 type CheckDBError struct{}
 
@@ -1,13 +1,16 @@
 package initialize
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"strings"
 
 	"github.com/VinukaThejana/auth/backend/config"
 	"github.com/VinukaThejana/auth/backend/models"
 	"github.com/fatih/color"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	gormLogger "gorm.io/gorm/logger"
 )
 
@@ -28,13 +31,57 @@ func (h *H) InitDB(env *config.Env) {
 	db.Logger = gormLogger.Default.LogMode(gormLogger.Info)
 
 	color.Blue("Running migrations ... ")
-	err = db.AutoMigrate(models.User{}, models.Sessions{})
+	err = db.AutoMigrate(models.User{}, models.Sessions{}, models.Identity{}, models.AuditLog{}, models.OAuthClient{}, models.Consent{}, models.OutboxEmail{}, models.OutboxAttempt{})
 	if err != nil {
 		errMsg := "Error running migrations !"
 		log.Errorf(err, &errMsg)
 	}
 
+	// INFO: Users that signed up with a provider before the identities were introduced
+	err = db.Exec(`
+		INSERT INTO identities (user_id, provider, provider_id, email)
+		SELECT id, provider, provider_id, email FROM users
+		WHERE provider <> 'local' AND provider_id <> ''
+		ON CONFLICT DO NOTHING
+	`).Error
+	if err != nil {
+		errMsg := "Error migrating the user identities !"
+		log.Errorf(err, &errMsg)
+	}
+
+	syncOAuthClients(db, env)
+
 	h.DB = &DB{
 		DB: db,
 	}
 }
+
+// syncOAuthClients is a function that is used to register the OAuth clients from the config in the database
+func syncOAuthClients(db *gorm.DB, env *config.Env) {
+	for _, client := range env.OAuthClients {
+		secret, authMethod := "", "none"
+		if client.ClientSecret != "" {
+			secret, authMethod = fmt.Sprintf("%x", sha256.Sum256([]byte(client.ClientSecret))), "client_secret_basic"
+		}
+
+		// INFO: The clients that already exist are left as they are so that the changes that the admins made
+		// with the client management API are kept
+		err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "client_id"}},
+			DoNothing: true,
+		}).Create(&models.OAuthClient{
+			ClientID:                client.ClientID,
+			ClientSecret:            secret,
+			Name:                    client.Name,
+			RedirectURIs:            strings.Join(client.RedirectURIs, " "),
+			GrantTypes:              strings.Join(client.GrantTypes, " "),
+			TokenEndpointAuthMethod: authMethod,
+			Scopes:                  strings.Join(client.Scopes, " "),
+			Status:                  models.ClientApproved,
+		}).Error
+		if err != nil {
+			errMsg := "Error registering the OAuth clients !"
+			log.Errorf(err, &errMsg)
+		}
+	}
+}
@@ -10,4 +10,5 @@ type H struct {
 	DB *DB
 	R  *Redis
 	S  *Storage
+	M  Mailer
 }
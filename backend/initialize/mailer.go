@@ -0,0 +1,318 @@
+package initialize
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/fatih/color"
+	"github.com/resendlabs/resend-go"
+)
+
+// MailerSendTimeout is the time that the mailers have to send an email, it is kept well below the lease
+// of the outbox so that the claimed emails are sent before the other workers can claim them again
+const MailerSendTimeout = 10 * time.Second
+
+// Message is an email that is sent with the mailer, the text body is optional
+type Message struct {
+	To      []string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Mailer is the backend that the emails are sent with
+type Mailer interface {
+	Send(message Message) error
+}
+
+// InitMailer is a function that is used to initialize the mailer that is selected with MAILER
+func (h *H) InitMailer(env *config.Env) {
+	sender := sender{
+		from:    env.EmailFrom,
+		replyTo: env.EmailReplyTo,
+	}
+
+	switch env.Mailer {
+	case "smtp":
+		h.M = &smtpMailer{
+			sender:   sender,
+			host:     env.SMTPHost,
+			port:     env.SMTPPort,
+			username: env.SMTPUsername,
+			password: env.SMTPPassword,
+			tls:      env.SMTPTLS,
+		}
+	case "sink":
+		if env.EmailSinkDir != "" {
+			err := os.MkdirAll(env.EmailSinkDir, 0o755)
+			if err != nil {
+				log.Errorf(err, nil)
+			}
+		}
+
+		color.Yellow("The emails are not delivered, they are written to the sink")
+		h.M = &sinkMailer{
+			sender: sender,
+			dir:    env.EmailSinkDir,
+		}
+	default:
+		h.M = &resendMailer{
+			sender: sender,
+			client: resend.NewCustomClient(&http.Client{Timeout: MailerSendTimeout}, env.ResendAPIKey),
+		}
+	}
+}
+
+// sender contains the addresses that the emails are sent from
+type sender struct {
+	from    string
+	replyTo string
+}
+
+type resendMailer struct {
+	sender
+	client *resend.Client
+}
+
+func (m *resendMailer) Send(message Message) error {
+	sent, err := m.client.Emails.Send(&resend.SendEmailRequest{
+		From:    m.from,
+		To:      message.To,
+		Subject: message.Subject,
+		Html:    message.HTML,
+		Text:    message.Text,
+		ReplyTo: m.replyTo,
+	})
+	if err != nil {
+		return err
+	}
+
+	// INFO: resend returns the response by value, the id is empty when the body could not be decoded
+	if sent.Id != "" {
+		log.Success(sent.Id)
+	}
+	return nil
+}
+
+type smtpMailer struct {
+	sender
+	host     string
+	port     int
+	username string
+	password string
+	tls      string
+}
+
+func (m *smtpMailer) Send(message Message) error {
+	from, err := mail.ParseAddress(m.from)
+	if err != nil {
+		return err
+	}
+
+	data, err := m.build(message)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.host, fmt.Sprint(m.port))
+	tlsConfig := &tls.Config{
+		ServerName: m.host,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	// INFO: The deadline covers the whole conversation with the server and not only the dial
+	deadline := time.Now().Add(MailerSendTimeout)
+
+	var conn net.Conn
+	dialer := &net.Dialer{
+		Deadline: deadline,
+	}
+	if m.tls == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = conn.SetDeadline(deadline)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if m.tls == "starttls" {
+		err = client.StartTLS(tlsConfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	// INFO: PlainAuth refuses to send the credentials over a connection that is not encrypted unless the
+	// server is localhost
+	if m.username != "" {
+		err = client.Auth(smtp.PlainAuth("", m.username, m.password, m.host))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = client.Mail(from.Address)
+	if err != nil {
+		return err
+	}
+	for _, to := range message.To {
+		err = client.Rcpt(to)
+		if err != nil {
+			return err
+		}
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(data)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+type sinkMailer struct {
+	sender
+	dir string
+}
+
+func (m *sinkMailer) Send(message Message) error {
+	data, err := m.build(message)
+	if err != nil {
+		return err
+	}
+
+	if m.dir == "" {
+		fmt.Printf("%s\n", data)
+		return nil
+	}
+
+	file := filepath.Join(m.dir, fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405"), randomHex(4)))
+	err = os.WriteFile(file, data, 0o644)
+	if err != nil {
+		return err
+	}
+
+	log.Success(file)
+	return nil
+}
+
+// build is a function that is used to create the MIME message (.eml) of the email, the message is
+// multipart/alternative when it has a text body
+func (s sender) build(message Message) ([]byte, error) {
+	var b bytes.Buffer
+
+	domain := "localhost"
+	if from, err := mail.ParseAddress(s.from); err == nil {
+		if _, d, found := strings.Cut(from.Address, "@"); found {
+			domain = d
+		}
+	}
+
+	headers := []string{
+		fmt.Sprintf("From: %s", s.from),
+		fmt.Sprintf("To: %s", strings.Join(message.To, ", ")),
+		fmt.Sprintf("Reply-To: %s", s.replyTo),
+		fmt.Sprintf("Subject: %s", mime.QEncoding.Encode("utf-8", message.Subject)),
+		fmt.Sprintf("Date: %s", time.Now().Format(time.RFC1123Z)),
+		fmt.Sprintf("Message-ID: <%s@%s>", randomHex(16), domain),
+		"MIME-Version: 1.0",
+	}
+
+	if message.Text == "" {
+		headers = append(headers,
+			"Content-Type: text/html; charset=utf-8",
+			"Content-Transfer-Encoding: quoted-printable",
+		)
+		b.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+		if err := writeQuotedPrintable(&b, message.HTML); err != nil {
+			return nil, err
+		}
+
+		return b.Bytes(), nil
+	}
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=utf-8", message.Text},
+		{"text/html; charset=utf-8", message.HTML},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              []string{part.contentType},
+			"Content-Transfer-Encoding": []string{"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(pw, part.content); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	headers = append(headers, fmt.Sprintf("Content-Type: multipart/alternative; boundary=%s", w.Boundary()))
+	b.WriteString(strings.Join(headers, "\r\n") + "\r\n\r\n")
+	b.Write(body.Bytes())
+
+	return b.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, content string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := qw.Write([]byte(content)); err != nil {
+		return err
+	}
+
+	return qw.Close()
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
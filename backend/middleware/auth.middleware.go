@@ -6,8 +6,10 @@ import (
 	"github.com/VinukaThejana/auth/backend/config"
 	"github.com/VinukaThejana/auth/backend/errors"
 	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
 	"github.com/VinukaThejana/auth/backend/utils"
 	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
 )
 
 // CheckAuth is a middleware function that is used to check wether the user is authed
@@ -19,7 +21,7 @@ func CheckAuth(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 		accessToken = strings.TrimPrefix(authorization, "Bearer ")
 	} else {
 		if c.Cookies("access_token") != "" {
-			accessToken = c.Cookies("accessToken")
+			accessToken = c.Cookies("access_token")
 		} else {
 			return c.Status(fiber.StatusForbidden).JSON(response{
 				Status: errors.ErrAccessTokenNotProvided.Error(),
@@ -55,6 +57,35 @@ func CheckAuth(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
 
 	c.Locals(config.Enums{}.USER(), tokenClaims.UserID)
 	c.Locals(config.Enums{}.ACCESSTOKENUUID(), tokenClaims.TokenUUID)
+	c.Locals(config.Enums{}.AUTHTIME(), tokenClaims.AuthTime)
+
+	return c.Next()
+}
+
+// CheckAdmin is a middleware function that is used to check wether the authed user is an admin, must be
+// used after CheckAuth
+func CheckAdmin(c *fiber.Ctx, h *initialize.H) error {
+	userID, _ := c.Locals(config.Enums{}.USER()).(string)
+
+	var user models.User
+	if err := h.DB.DB.Select("role").First(&user, "id = ?", userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return c.Status(fiber.StatusUnauthorized).JSON(response{
+				Status: errors.ErrUnauthorized.Error(),
+			})
+		}
+
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(response{
+			Status: errors.ErrInternalServerError.Error(),
+		})
+	}
+
+	if user.Role == nil || *user.Role != models.AdminRole {
+		return c.Status(fiber.StatusForbidden).JSON(response{
+			Status: errors.ErrForbidden.Error(),
+		})
+	}
 
 	return c.Next()
 }
@@ -0,0 +1,27 @@
+package middleware
+
+import (
+	"crypto/subtle"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/gofiber/fiber/v2"
+)
+
+// CheckInternal is a middleware function that is used to check wether the request is made by one of
+// our internal services, the internal endpoints are disabled when the internal API key is not configured
+func CheckInternal(c *fiber.Ctx, env *config.Env) error {
+	if env.InternalAPIKey == "" {
+		return c.Status(fiber.StatusNotFound).JSON(response{
+			Status: errors.ErrNotFound.Error(),
+		})
+	}
+
+	if subtle.ConstantTimeCompare([]byte(c.Get("X-Internal-API-Key")), []byte(env.InternalAPIKey)) != 1 {
+		return c.Status(fiber.StatusUnauthorized).JSON(response{
+			Status: errors.ErrUnauthorized.Error(),
+		})
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// registrationLimit is the number of clients that can be registered from an IP address in registrationWindow
+	registrationLimit  = 5
+	registrationWindow = time.Hour
+)
+
+// CheckRegistration is a middleware function that is used to check the initial access token of the dynamic
+// client registration (when it is configured) and to limit the number of registrations from an IP address
+func CheckRegistration(c *fiber.Ctx, h *initialize.H, env *config.Env) error {
+	if env.OAuthRegistrationToken != "" {
+		token := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(env.OAuthRegistrationToken)) != 1 {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+			return c.Status(fiber.StatusUnauthorized).JSON(schemas.OAuthError{
+				Error: errors.ErrInvalidToken.Error(),
+			})
+		}
+	}
+
+	ok, err := utils.RateLimit(context.TODO(), h.R.RR, fmt.Sprintf("client_registration:%s", c.IP()), registrationLimit, registrationWindow)
+	if err != nil {
+		log.Error(err, nil)
+		return c.Status(fiber.StatusInternalServerError).JSON(schemas.OAuthError{
+			Error: errors.ErrServerError.Error(),
+		})
+	}
+	if !ok {
+		return c.Status(fiber.StatusTooManyRequests).JSON(schemas.OAuthError{
+			Error: errors.ErrTooManyRequests.Error(),
+		})
+	}
+
+	return c.Next()
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AuditLog is a model that records the security relevant changes that are made to the user account
+type AuditLog struct {
+	ID        *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID    uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Action    string     `gorm:"type:varchar(50);not null"`
+	Details   string     `gorm:"type:varchar(255)"`
+	IPAddress string     `gorm:"type:varchar(50)"`
+	CreatedAt *time.Time `gorm:"not null;default:now()"`
+}
+
+const (
+	//revive:disable
+	AuditIdentityLinked        = "identity_linked"
+	AuditIdentityUnlinked      = "identity_unlinked"
+	AuditIdentityLinkedByEmail = "identity_linked_by_email"
+	AuditPasswordReset         = "password_reset"
+	//revive:enable
+)
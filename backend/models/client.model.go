@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OAuthClient is a model that represents an application that logs the users in with this service, the
+// ClientSecret is the SHA256 hash of the secret (empty for public clients) and the RedirectURIs, the
+// GrantTypes and the Scopes are space separated
+type OAuthClient struct {
+	ID                      *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	ClientID                string     `gorm:"type:varchar(100);uniqueIndex;not null"`
+	ClientSecret            string     `gorm:"type:varchar(64)"`
+	Name                    string     `gorm:"type:varchar(100);not null"`
+	RedirectURIs            string     `gorm:"type:text;not null"`
+	GrantTypes              string     `gorm:"type:text;not null;default:'authorization_code refresh_token'"`
+	TokenEndpointAuthMethod string     `gorm:"type:varchar(30);not null;default:'client_secret_basic'"`
+	Scopes                  string     `gorm:"type:text;not null;default:''"`
+	Status                  string     `gorm:"type:varchar(20);not null;default:'approved'"`
+	CreatedAt               *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt               *time.Time `gorm:"not null;default:now()"`
+}
+
+const (
+	//revive:disable
+	ClientPending  = "pending"
+	ClientApproved = "approved"
+	//revive:enable
+)
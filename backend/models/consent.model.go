@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Consent is a model that represents the scopes that the user allowed an OAuth client to access, the Scopes
+// are space separated
+type Consent struct {
+	ID        *uuid.UUID  `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID    uuid.UUID   `gorm:"type:uuid;not null;uniqueIndex:idx_consents_user_client"`
+	ClientID  string      `gorm:"type:varchar(100);not null;uniqueIndex:idx_consents_user_client"`
+	Client    OAuthClient `gorm:"foreignKey:ClientID;references:ClientID;constraint:OnDelete:CASCADE"`
+	Scopes    string      `gorm:"type:text;not null;default:''"`
+	GrantedAt *time.Time  `gorm:"not null;default:now()"`
+	UpdatedAt *time.Time  `gorm:"not null;default:now()"`
+}
@@ -0,0 +1,24 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity is a model that represents a provider account (GitHub, Apple, OIDC ...) that is linked to a user
+type Identity struct {
+	ID         *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	UserID     uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_identities_user_provider"`
+	Provider   string     `gorm:"type:varchar(50);not null;uniqueIndex:idx_identities_provider_id;uniqueIndex:idx_identities_user_provider"`
+	ProviderID string     `gorm:"type:varchar(100);not null;uniqueIndex:idx_identities_provider_id"`
+	Email      string     `gorm:"type:varchar(100)"`
+
+	// AccessToken and RefreshToken are the encrypted tokens that are issued by the provider
+	AccessToken    []byte `gorm:"type:bytea"`
+	RefreshToken   []byte `gorm:"type:bytea"`
+	TokenType      string `gorm:"type:varchar(20)"`
+	TokenExpiresAt *time.Time
+	CreatedAt      *time.Time `gorm:"not null;default:now()"`
+	UpdatedAt      *time.Time `gorm:"not null;default:now()"`
+}
@@ -0,0 +1,44 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OutboxEmail is a model that represents an email that is delivered by the outbox worker, the recipients
+// are space separated and the email is dead when it could not be delivered after all the attempts, the body is
+// cleared once the email is sent or has expired as it contains the tokens of the users
+type OutboxEmail struct {
+	ID            *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	To            string     `gorm:"type:text;not null"`
+	Subject       string     `gorm:"type:varchar(255);not null"`
+	HTML          string     `gorm:"type:text;not null"`
+	Text          string     `gorm:"type:text;not null;default:''"`
+	Status        string     `gorm:"type:varchar(20);not null;default:'pending';index:idx_outbox_emails_status_next_attempt_at"`
+	Attempts      int        `gorm:"not null;default:0"`
+	LastError     string     `gorm:"type:text;not null;default:''"`
+	NextAttemptAt *time.Time `gorm:"not null;default:now();index:idx_outbox_emails_status_next_attempt_at"`
+	SentAt        *time.Time
+	ExpiresAt     *time.Time      `gorm:"index"`
+	CreatedAt     *time.Time      `gorm:"not null;default:now()"`
+	UpdatedAt     *time.Time      `gorm:"not null;default:now()"`
+	History       []OutboxAttempt `gorm:"foreignKey:EmailID;constraint:OnDelete:CASCADE"`
+}
+
+// OutboxAttempt is a model that records an attempt to deliver the outbox email, the error is empty when
+// the email was delivered
+type OutboxAttempt struct {
+	ID        *uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primary_key"`
+	EmailID   uuid.UUID  `gorm:"type:uuid;not null;index"`
+	Error     string     `gorm:"type:text;not null;default:''"`
+	CreatedAt *time.Time `gorm:"not null;default:now()"`
+}
+
+const (
+	//revive:disable
+	OutboxPending = "pending"
+	OutboxSent    = "sent"
+	OutboxDead    = "dead"
+	//revive:enable
+)
@@ -6,10 +6,12 @@ import (
 	"github.com/google/uuid"
 )
 
-// Sessions is a model that represents the sessions in the relational database
+// Sessions is a model that represents the sessions in the relational database, the ClientID is set
+// when the session belongs to an OAuth client instead of our own frontend
 type Sessions struct {
 	TokenID   uuid.UUID `gorm:"type:uuid;primary_key"`
 	UserID    uuid.UUID `gorm:"type:uuid"`
+	ClientID  string    `gorm:"type:varchar(100);index"`
 	IPAddress string
 	Location  string
 	Device    string
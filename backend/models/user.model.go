@@ -17,13 +17,32 @@ type User struct {
 	Provider   *string    `gorm:"type:varchar(50);default:'local';not null"`
 	ProviderID string     `gorm:"type:varchar(100)"`
 	Verified   *bool      `gorm:"not null;default:false"`
+	AvatarURL  string     `gorm:"type:varchar(500)"`
+	ProfileURL string     `gorm:"type:varchar(500)"`
+	Locale     string     `gorm:"type:varchar(35)"`
+
+	// ProfileOverrides contains the space separated profile attributes (avatar_url, profile_url, locale)
+	// that the user has set, they are no longer refreshed from the providers
+	ProfileOverrides string `gorm:"type:text;not null;default:''"`
+
 	CreatedAt  *time.Time `gorm:"not null;default:now()"`
 	UpdatedAt  *time.Time `gorm:"not null;default:now()"`
 	Sessions   []Sessions `gorm:"foreignKey:UserID"`
+	Identities []Identity `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
+	Consents   []Consent  `gorm:"foreignKey:UserID;constraint:OnDelete:CASCADE"`
 }
 
 const (
 	//revive:disable
 	GitHubProvider = "github"
+	AppleProvider  = "apple"
+	LDAPProvider   = "ldap"
+
+	AvatarURLAttribute  = "avatar_url"
+	ProfileURLAttribute = "profile_url"
+	LocaleAttribute     = "locale"
+
+	UserRole  = "user"
+	AdminRole = "admin"
 	//revive:enable
 )
@@ -0,0 +1,98 @@
+package schemas
+
+import (
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/models"
+)
+
+// ClientMetadataInput contains the metadata of an OAuth client that is sent with the dynamic client
+// registration request (RFC 7591) or by an admin to update the client
+type ClientMetadataInput struct {
+	RedirectURIs            []string `json:"redirect_uris"`
+	ClientName              string   `json:"client_name"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	Scope                   string   `json:"scope"`
+}
+
+// ClientResponse is a struct that contains the relevant feilds of the models.OAuthClient when sending
+// the client to the client side, the secret is only set when it is issued
+type ClientResponse struct {
+	ClientID                string   `json:"client_id"`
+	ClientSecret            string   `json:"client_secret,omitempty"`
+	ClientIDIssuedAt        int64    `json:"client_id_issued_at"`
+	ClientSecretExpiresAt   *int64   `json:"client_secret_expires_at,omitempty"`
+	ClientName              string   `json:"client_name"`
+	RedirectURIs            []string `json:"redirect_uris"`
+	GrantTypes              []string `json:"grant_types"`
+	ResponseTypes           []string `json:"response_types"`
+	TokenEndpointAuthMethod string   `json:"token_endpoint_auth_method"`
+	Scope                   string   `json:"scope"`
+	Status                  string   `json:"status"`
+}
+
+// FilterClientRecord is a function that is used to filter the models.OAuthClient struct to a client freindly manner
+func FilterClientRecord(client *models.OAuthClient, secret string) ClientResponse {
+	record := ClientResponse{
+		ClientID:                client.ClientID,
+		ClientIDIssuedAt:        client.CreatedAt.Unix(),
+		ClientName:              client.Name,
+		RedirectURIs:            strings.Fields(client.RedirectURIs),
+		GrantTypes:              strings.Fields(client.GrantTypes),
+		ResponseTypes:           []string{},
+		TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+		Scope:                   client.Scopes,
+		Status:                  client.Status,
+	}
+
+	for _, grantType := range record.GrantTypes {
+		if grantType == "authorization_code" {
+			record.ResponseTypes = []string{"code"}
+		}
+	}
+
+	if secret != "" {
+		// INFO: The client secrets do not expire
+		record.ClientSecret = secret
+		record.ClientSecretExpiresAt = new(int64)
+	}
+
+	return record
+}
+
+// FilterClientRecords is a function that is used to filter the models.OAuthClient structs to a client freindly manner
+func FilterClientRecords(clients []models.OAuthClient) []ClientResponse {
+	records := make([]ClientResponse, 0, len(clients))
+	for i := range clients {
+		records = append(records, FilterClientRecord(&clients[i], ""))
+	}
+
+	return records
+}
+
+// ConsentResponse is a struct that contains the relevant feilds of the models.Consent when sending the
+// consents of the user to the client side
+type ConsentResponse struct {
+	ClientID   string    `json:"client_id"`
+	ClientName string    `json:"client_name"`
+	Scopes     []string  `json:"scopes"`
+	GrantedAt  time.Time `json:"granted_at"`
+}
+
+// FilterConsentRecords is a function that is used to filter the models.Consent structs to a client freindly manner
+func FilterConsentRecords(consents []models.Consent) []ConsentResponse {
+	records := make([]ConsentResponse, 0, len(consents))
+	for _, consent := range consents {
+		records = append(records, ConsentResponse{
+			ClientID:   consent.ClientID,
+			ClientName: consent.Client.Name,
+			Scopes:     strings.Fields(consent.Scopes),
+			GrantedAt:  *consent.GrantedAt,
+		})
+	}
+
+	return records
+}
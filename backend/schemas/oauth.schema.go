@@ -1,11 +1,17 @@
 package schemas
 
+import "fmt"
+
 // BasicOAuthProvider contains all the common feils related to oauth providers
 type BasicOAuthProvider struct {
-	ID       string
-	Name     string
-	Username string
-	Email    *string
+	ID            string
+	Name          string
+	Username      string
+	Email         *string
+	EmailVerified bool
+	AvatarURL     string
+	ProfileURL    string
+	Locale        string
 }
 
 // GitHub struct contains the needed data that is received from GitHub after OAuth login
@@ -14,14 +20,118 @@ type GitHub struct {
 	Name      string  `json:"name"`
 	Username  string  `json:"login"`
 	AvatarURL string  `json:"avatar_url"`
+	HTMLURL   string  `json:"html_url"`
 	Email     *string `json:"email"`
+	// EmailVerified is true only when the email is the primary verified email of the GitHub account
+	EmailVerified bool `json:"-"`
+}
+
+// ToBasicOAuthProvider is a function that is used to convert the GitHub profile to the common profile
+func (g GitHub) ToBasicOAuthProvider() BasicOAuthProvider {
+	return BasicOAuthProvider{
+		ID:            fmt.Sprint(g.ID),
+		Name:          g.Name,
+		Username:      g.Username,
+		Email:         g.Email,
+		EmailVerified: g.EmailVerified,
+		AvatarURL:     g.AvatarURL,
+		ProfileURL:    g.HTMLURL,
+	}
+}
+
+// GitHubEmail contains an email address of the GitHub account that is received from the /user/emails api
+type GitHubEmail struct {
+	Email      string `json:"email"`
+	Primary    bool   `json:"primary"`
+	Verified   bool   `json:"verified"`
+	Visibility string `json:"visibility"`
 }
 
 // GetEmailFromPayload is a function that is used to extract the email feild from the api
 func (GitHub) GetEmailFromPayload(payload map[string]interface{}) *string {
-	if email, ok := payload["email"].(*string); ok && email != nil {
-		return email
+	if email, ok := payload["email"].(string); ok && email != "" {
+		return &email
 	}
 
 	return nil
 }
+
+// Apple struct contains the needed data that is received from Apple after OAuth login
+type Apple struct {
+	ID             string
+	Name           string
+	Email          *string
+	EmailVerified  bool
+	IsPrivateEmail bool
+}
+
+// ToBasicOAuthProvider is a function that is used to convert the Apple profile to the common profile
+func (a Apple) ToBasicOAuthProvider() BasicOAuthProvider {
+	return BasicOAuthProvider{
+		ID:            a.ID,
+		Name:          a.Name,
+		Email:         a.Email,
+		EmailVerified: a.EmailVerified,
+	}
+}
+
+// AppleUser is the user object that is posted by Apple to the callback, only on the first login
+type AppleUser struct {
+	Name struct {
+		FirstName string `json:"firstName"`
+		LastName  string `json:"lastName"`
+	} `json:"name"`
+	Email string `json:"email"`
+}
+
+// OIDCDiscovery contains the needed fields of the OpenID Connect discovery document
+type OIDCDiscovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksURI                           string   `json:"jwks_uri"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+}
+
+// OAuthToken contains the token response of an OAuth provider
+type OAuthToken struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+}
+
+// OAuthState contains the data that is bound to the state parameter of the OAuth redirect flow
+type OAuthState struct {
+	Provider     string
+	BindingHash  string
+	CodeVerifier string
+	Nonce        string
+	ReturnTo     string
+	// LinkUserID is set when a logged in user is linking the provider account instead of logging in
+	LinkUserID string
+}
+
+// PendingLink contains the provider account that is waiting for the owner of the email address to
+// confirm the link to the local account
+type PendingLink struct {
+	UserID   string
+	Email    string
+	Provider string
+	Profile  BasicOAuthProvider
+}
+
+// SignupTicket contains the provider account of a user that has to choose a username to complete the signup
+type SignupTicket struct {
+	Provider string
+	Profile  BasicOAuthProvider
+}
+
+// CompleteSignupInput is a struct that defines what the server expects from the user to complete the signup,
+// the signup ticket is sent in the signup_ticket cookie
+type CompleteSignupInput struct {
+	Username string `json:"username" validate:"required,min=3,max=20"`
+}
@@ -0,0 +1,69 @@
+package schemas
+
+import (
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/models"
+)
+
+// OutboxEmailResponse is a struct that contains the relevant feilds of the models.OutboxEmail when sending
+// the emails of the outbox to the admins, the body is left out as it contains the tokens of the users
+type OutboxEmailResponse struct {
+	ID            string                  `json:"id"`
+	To            []string                `json:"to"`
+	Subject       string                  `json:"subject"`
+	Status        string                  `json:"status"`
+	Attempts      int                     `json:"attempts"`
+	LastError     string                  `json:"last_error,omitempty"`
+	NextAttemptAt *time.Time              `json:"next_attempt_at,omitempty"`
+	SentAt        *time.Time              `json:"sent_at,omitempty"`
+	ExpiresAt     *time.Time              `json:"expires_at,omitempty"`
+	CreatedAt     time.Time               `json:"created_at"`
+	History       []OutboxAttemptResponse `json:"history,omitempty"`
+}
+
+// OutboxAttemptResponse is a struct that contains an attempt to deliver the outbox email, the error is
+// empty when the email was delivered
+type OutboxAttemptResponse struct {
+	Error     string    `json:"error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FilterOutboxEmailRecord is a function that is used to filter the models.OutboxEmail struct to a client freindly manner
+func FilterOutboxEmailRecord(email *models.OutboxEmail) OutboxEmailResponse {
+	record := OutboxEmailResponse{
+		ID:        email.ID.String(),
+		To:        strings.Fields(email.To),
+		Subject:   email.Subject,
+		Status:    email.Status,
+		Attempts:  email.Attempts,
+		LastError: email.LastError,
+		SentAt:    email.SentAt,
+		ExpiresAt: email.ExpiresAt,
+		CreatedAt: *email.CreatedAt,
+	}
+
+	if email.Status == models.OutboxPending {
+		record.NextAttemptAt = email.NextAttemptAt
+	}
+
+	for _, attempt := range email.History {
+		record.History = append(record.History, OutboxAttemptResponse{
+			Error:     attempt.Error,
+			CreatedAt: *attempt.CreatedAt,
+		})
+	}
+
+	return record
+}
+
+// FilterOutboxEmailRecords is a function that is used to filter the models.OutboxEmail structs to a client freindly manner
+func FilterOutboxEmailRecords(emails []models.OutboxEmail) []OutboxEmailResponse {
+	records := make([]OutboxEmailResponse, 0, len(emails))
+	for i := range emails {
+		records = append(records, FilterOutboxEmailRecord(&emails[i]))
+	}
+
+	return records
+}
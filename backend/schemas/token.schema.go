@@ -1,7 +1,19 @@
 package schemas
 
+import "time"
+
 // RefreshTokenDetails is a struct that contains details about the refresh token
 type RefreshTokenDetails struct {
 	UserID          string
 	AccessTokenUUID string
+	ClientID        string `json:",omitempty"`
+	Scope           string `json:",omitempty"`
+	AuthTime        int64  `json:",omitempty"`
+}
+
+// ProviderToken is a struct that contains the access token that is issued by the provider of a linked account
+type ProviderToken struct {
+	AccessToken string     `json:"access_token"`
+	TokenType   string     `json:"token_type"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
 }
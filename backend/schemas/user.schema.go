@@ -2,6 +2,7 @@ package schemas
 
 import (
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/VinukaThejana/auth/backend/models"
@@ -43,6 +44,84 @@ func (lI LoginInput) Validate() (err error) {
 	return err
 }
 
+// ForgotPasswordInput is a struct that defines what the server expects from the user to send the password
+// reset email
+type ForgotPasswordInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// Validate is a function that is used to validate the user input to send the password reset email
+func (fI ForgotPasswordInput) Validate() (err error) {
+	v := validator.New()
+	err = v.Struct(fI)
+	return err
+}
+
+// ResetPasswordInput is a struct that defines what the server expects from the user to reset the password
+// with the token of the password reset email
+type ResetPasswordInput struct {
+	Token                string `json:"token" validate:"required,max=100"`
+	Password             string `json:"password" validate:"required,min=8,max=200"`
+	PasswordConfirmation string `json:"password_confirm" validate:"required,min=8,max=200"`
+}
+
+// Validate is a function that is used to validate the user input to reset the password
+func (rI ResetPasswordInput) Validate() (err error) {
+	v := validator.New()
+	err = v.Struct(rI)
+	return err
+}
+
+// MagicLinkInput is a struct that defines what the server expects from the user to send the magic link
+type MagicLinkInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// Validate is a function that is used to validate the user input to send the magic link
+func (mI MagicLinkInput) Validate() (err error) {
+	v := validator.New()
+	err = v.Struct(mI)
+	return err
+}
+
+// OTPRequestInput is a struct that defines what the server expects from the user to send the login code
+type OTPRequestInput struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+// Validate is a function that is used to validate the user input to send the login code
+func (oI OTPRequestInput) Validate() (err error) {
+	v := validator.New()
+	err = v.Struct(oI)
+	return err
+}
+
+// OTPVerifyInput is a struct that defines what the server expects from the user to log in with the code
+type OTPVerifyInput struct {
+	Email string `json:"email" validate:"required,email"`
+	Code  string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// Validate is a function that is used to validate the user input to log in with the code
+func (oI OTPVerifyInput) Validate() (err error) {
+	v := validator.New()
+	err = v.Struct(oI)
+	return err
+}
+
+// EmailCodeInput is a struct that defines what the server expects from the user to confirm the email
+// address with the code of the confirmation email
+type EmailCodeInput struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// Validate is a function that is used to validate the user input to confirm the email address with the code
+func (eI EmailCodeInput) Validate() (err error) {
+	v := validator.New()
+	err = v.Struct(eI)
+	return err
+}
+
 // User struct contians the most basic data that needs to be stored from a user
 type User struct {
 	ID       string `json:"id"`
@@ -54,26 +133,123 @@ type User struct {
 // UserResponse is a struct that contains all the relevant feilds of the models.User when sending the
 // user session to the client side
 type UserResponse struct {
-	ID        uuid.UUID `json:"id,omitempty"`
-	Name      string    `json:"name,omitempty"`
-	Username  string    `json:"username,omitempty"`
-	Email     string    `json:"email,omitempty"`
-	Role      string    `json:"role,omitempty"`
-	Provider  string    `json:"provider"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         uuid.UUID `json:"id,omitempty"`
+	Name       string    `json:"name,omitempty"`
+	Username   string    `json:"username,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	Role       string    `json:"role,omitempty"`
+	Provider   string    `json:"provider"`
+	Verified   bool      `json:"verified"`
+	AvatarURL  string    `json:"avatar_url,omitempty"`
+	ProfileURL string    `json:"profile_url,omitempty"`
+	Locale     string    `json:"locale,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// UpdateProfileInput contains the profile attributes that the user sets, the attributes that are left
+// out are not changed and the attributes that are empty are refreshed from the providers again
+type UpdateProfileInput struct {
+	AvatarURL  *string `json:"avatar_url" validate:"omitempty,max=500"`
+	ProfileURL *string `json:"profile_url" validate:"omitempty,max=500"`
+	Locale     *string `json:"locale" validate:"omitempty,max=35"`
+}
+
+// Validate is a function that is used to validate the profile attributes, the empty attributes are allowed
+// as they clear the overrides
+func (uP UpdateProfileInput) Validate() (err error) {
+	v := validator.New()
+	if err = v.Struct(uP); err != nil {
+		return err
+	}
+
+	for _, u := range []*string{uP.AvatarURL, uP.ProfileURL} {
+		if u == nil || *u == "" {
+			continue
+		}
+
+		if err = v.Var(*u, "http_url"); err != nil {
+			return err
+		}
+	}
+
+	if uP.Locale != nil && *uP.Locale != "" {
+		err = v.Var(*uP.Locale, "bcp47_language_tag")
+	}
+
+	return err
 }
 
 // FilterUserRecord is a funcion that is used to filter the models.User struct to a client freindly manner
 func FilterUserRecord(user *models.User) UserResponse {
 	return UserResponse{
-		ID:        *user.ID,
-		Name:      user.Name,
-		Username:  user.Username,
-		Email:     user.Email,
-		Role:      *user.Role,
-		Provider:  *user.Provider,
-		CreatedAt: *user.CreatedAt,
-		UpdatedAt: *user.UpdatedAt,
+		ID:         *user.ID,
+		Name:       user.Name,
+		Username:   user.Username,
+		Email:      user.Email,
+		Role:       *user.Role,
+		Provider:   *user.Provider,
+		Verified:   user.Verified != nil && *user.Verified,
+		AvatarURL:  user.AvatarURL,
+		ProfileURL: user.ProfileURL,
+		Locale:     user.Locale,
+		CreatedAt:  *user.CreatedAt,
+		UpdatedAt:  *user.UpdatedAt,
+	}
+}
+
+// FilterUserClaims is a function that is used to get the OpenID Connect claims of the user that the given
+// space separated scopes allow (the subject is always included)
+func FilterUserClaims(user *models.User, scope string) map[string]interface{} {
+	record := FilterUserRecord(user)
+	claims := map[string]interface{}{
+		"sub": record.ID.String(),
 	}
+
+	for _, s := range strings.Fields(scope) {
+		switch s {
+		case "profile":
+			claims["name"] = record.Name
+			claims["preferred_username"] = record.Username
+			claims["updated_at"] = record.UpdatedAt.Unix()
+			if record.AvatarURL != "" {
+				claims["picture"] = record.AvatarURL
+			}
+			if record.ProfileURL != "" {
+				claims["profile"] = record.ProfileURL
+			}
+			if record.Locale != "" {
+				claims["locale"] = record.Locale
+			}
+		case "email":
+			if record.Email != "" {
+				claims["email"] = record.Email
+				claims["email_verified"] = record.Verified
+			}
+		}
+	}
+
+	return claims
+}
+
+// IdentityResponse is a struct that contains the relevant feilds of the models.Identity when sending the
+// linked provider accounts to the client side
+type IdentityResponse struct {
+	Provider  string    `json:"provider"`
+	Email     string    `json:"email,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FilterIdentityRecords is a function that is used to filter the models.Identity structs to a client freindly manner
+func FilterIdentityRecords(identities []models.Identity) []IdentityResponse {
+	records := make([]IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		records = append(records, IdentityResponse{
+			Provider:  identity.Provider,
+			Email:     identity.Email,
+			CreatedAt: *identity.CreatedAt,
+		})
+	}
+
+	return records
 }
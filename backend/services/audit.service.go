@@ -0,0 +1,25 @@
+package services
+
+import (
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/google/uuid"
+)
+
+// Audit contains the operations on the audit log of the users
+type Audit struct{}
+
+// Record is a function that is used to record a change that is made to the user account
+func (Audit) Record(h *initialize.H, userID, action, details, ipAddress string) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return err
+	}
+
+	return h.DB.DB.Create(&models.AuditLog{
+		UserID:    uid,
+		Action:    action,
+		Details:   details,
+		IPAddress: ipAddress,
+	}).Error
+}
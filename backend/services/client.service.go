@@ -0,0 +1,361 @@
+package services
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"gorm.io/gorm"
+)
+
+// DeviceCodeGrantType is the grant type of the device authorization grant (RFC 8628)
+const DeviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+var (
+	// SupportedScopes contains the scopes that the OAuth clients can request
+	SupportedScopes = []string{"openid", "profile", "email"}
+	// SupportedGrantTypes contains the grant types that the OAuth clients can use
+	SupportedGrantTypes = []string{"authorization_code", "refresh_token", DeviceCodeGrantType}
+	// SupportedTokenEndpointAuthMethods contains the ways that the OAuth clients can authenticate
+	SupportedTokenEndpointAuthMethods = []string{"client_secret_basic", "client_secret_post", "none"}
+)
+
+// Client contains the operations on the OAuth clients
+type Client struct{}
+
+// Get is a function that is used to get the approved OAuth client with the given client ID
+func (Client) Get(h *initialize.H, clientID string) (models.OAuthClient, error) {
+	client, err := Client{}.Find(h, clientID)
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+
+	if client.Status != models.ClientApproved {
+		return models.OAuthClient{}, errors.ErrClientNotFound
+	}
+
+	return client, nil
+}
+
+// Find is a function that is used to get the OAuth client with the given client ID regardless of its status
+func (Client) Find(h *initialize.H, clientID string) (client models.OAuthClient, err error) {
+	if clientID == "" {
+		return models.OAuthClient{}, errors.ErrClientNotFound
+	}
+
+	err = h.DB.DB.Where("client_id = ?", clientID).First(&client).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return models.OAuthClient{}, errors.ErrClientNotFound
+		}
+
+		return models.OAuthClient{}, err
+	}
+
+	return client, nil
+}
+
+// List is a function that is used to list all the OAuth clients
+func (Client) List(h *initialize.H) (clients []models.OAuthClient, err error) {
+	err = h.DB.DB.Order("created_at").Find(&clients).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return clients, nil
+}
+
+// Register is a function that is used to register a new OAuth client with the given metadata, the client
+// can not be used until an admin approves it
+func (Client) Register(h *initialize.H, payload schemas.ClientMetadataInput) (client models.OAuthClient, secret string, err error) {
+	payload, err = Client{}.ValidateMetadata(payload)
+	if err != nil {
+		return models.OAuthClient{}, "", err
+	}
+
+	clientID, err := utils.RandomString(16)
+	if err != nil {
+		return models.OAuthClient{}, "", err
+	}
+
+	client = models.OAuthClient{
+		ClientID:                clientID,
+		Name:                    payload.ClientName,
+		RedirectURIs:            strings.Join(payload.RedirectURIs, " "),
+		GrantTypes:              strings.Join(payload.GrantTypes, " "),
+		TokenEndpointAuthMethod: payload.TokenEndpointAuthMethod,
+		Scopes:                  payload.Scope,
+		Status:                  models.ClientPending,
+	}
+
+	if payload.TokenEndpointAuthMethod != "none" {
+		secret, err = utils.RandomString(32)
+		if err != nil {
+			return models.OAuthClient{}, "", err
+		}
+		client.ClientSecret = utils.Hash(secret)
+	}
+
+	err = h.DB.DB.Create(&client).Error
+	if err != nil {
+		return models.OAuthClient{}, "", err
+	}
+
+	return client, secret, nil
+}
+
+// Update is a function that is used to update the metadata of the OAuth client, the fields that are not
+// given are kept as they are
+func (Client) Update(h *initialize.H, clientID string, payload schemas.ClientMetadataInput) (models.OAuthClient, error) {
+	client, err := Client{}.Find(h, clientID)
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+
+	metadata := schemas.ClientMetadataInput{
+		RedirectURIs:            strings.Fields(client.RedirectURIs),
+		ClientName:              client.Name,
+		GrantTypes:              strings.Fields(client.GrantTypes),
+		TokenEndpointAuthMethod: client.TokenEndpointAuthMethod,
+		Scope:                   client.Scopes,
+	}
+	if len(payload.RedirectURIs) > 0 {
+		metadata.RedirectURIs = payload.RedirectURIs
+	}
+	if payload.ClientName != "" {
+		metadata.ClientName = payload.ClientName
+	}
+	if len(payload.GrantTypes) > 0 {
+		metadata.GrantTypes = payload.GrantTypes
+	}
+	if len(payload.ResponseTypes) > 0 {
+		metadata.ResponseTypes = payload.ResponseTypes
+	}
+	if payload.Scope != "" {
+		metadata.Scope = payload.Scope
+	}
+	if payload.TokenEndpointAuthMethod != "" {
+		// INFO: A public client can not become a confidential client (or the other way around) as it does not have a secret
+		if (payload.TokenEndpointAuthMethod == "none") != (client.TokenEndpointAuthMethod == "none") {
+			return models.OAuthClient{}, errors.ErrInvalidClientMetadata
+		}
+		metadata.TokenEndpointAuthMethod = payload.TokenEndpointAuthMethod
+	}
+
+	metadata, err = Client{}.ValidateMetadata(metadata)
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+
+	err = h.DB.DB.Model(&client).Updates(map[string]interface{}{
+		"name":                       metadata.ClientName,
+		"redirect_uris":              strings.Join(metadata.RedirectURIs, " "),
+		"grant_types":                strings.Join(metadata.GrantTypes, " "),
+		"token_endpoint_auth_method": metadata.TokenEndpointAuthMethod,
+		"scopes":                     metadata.Scope,
+	}).Error
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+
+	return Client{}.Find(h, clientID)
+}
+
+// Approve is a function that is used to approve the OAuth client so that it can be used
+func (Client) Approve(h *initialize.H, clientID string) (models.OAuthClient, error) {
+	client, err := Client{}.Find(h, clientID)
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+
+	err = h.DB.DB.Model(&client).Update("status", models.ClientApproved).Error
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+	client.Status = models.ClientApproved
+
+	return client, nil
+}
+
+// RotateSecret is a function that is used to replace the secret of the confidential OAuth client, the old
+// secret stops working immediately
+func (Client) RotateSecret(h *initialize.H, clientID string) (models.OAuthClient, string, error) {
+	client, err := Client{}.Find(h, clientID)
+	if err != nil {
+		return models.OAuthClient{}, "", err
+	}
+
+	if client.TokenEndpointAuthMethod == "none" {
+		return models.OAuthClient{}, "", errors.ErrInvalidClientMetadata
+	}
+
+	secret, err := utils.RandomString(32)
+	if err != nil {
+		return models.OAuthClient{}, "", err
+	}
+
+	err = h.DB.DB.Model(&client).Update("client_secret", utils.Hash(secret)).Error
+	if err != nil {
+		return models.OAuthClient{}, "", err
+	}
+
+	return client, secret, nil
+}
+
+// Delete is a function that is used to delete the OAuth client
+func (Client) Delete(h *initialize.H, clientID string) error {
+	result := h.DB.DB.Where("client_id = ?", clientID).Delete(&models.OAuthClient{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrClientNotFound
+	}
+
+	return nil
+}
+
+// ValidateMetadata is a function that is used to validate the metadata of the OAuth client and to fill in
+// the defaults of RFC 7591
+func (Client) ValidateMetadata(payload schemas.ClientMetadataInput) (schemas.ClientMetadataInput, error) {
+	payload.ClientName = strings.TrimSpace(payload.ClientName)
+	if payload.ClientName == "" || len(payload.ClientName) > 100 {
+		return payload, errors.ErrInvalidClientMetadata
+	}
+
+	if len(payload.GrantTypes) == 0 {
+		payload.GrantTypes = []string{"authorization_code"}
+	}
+	for _, grantType := range payload.GrantTypes {
+		if !utils.Contains(SupportedGrantTypes, grantType) {
+			return payload, errors.ErrInvalidClientMetadata
+		}
+	}
+
+	// INFO: Only the clients that use the authorization code grant are redirected back (not the devices)
+	if len(payload.RedirectURIs) == 0 && utils.Contains(payload.GrantTypes, "authorization_code") {
+		return payload, errors.ErrInvalidRedirectURI
+	}
+	for _, redirectURI := range payload.RedirectURIs {
+		if !isValidRedirectURI(redirectURI) {
+			return payload, errors.ErrInvalidRedirectURI
+		}
+	}
+
+	if len(payload.ResponseTypes) == 0 && utils.Contains(payload.GrantTypes, "authorization_code") {
+		payload.ResponseTypes = []string{"code"}
+	}
+	for _, responseType := range payload.ResponseTypes {
+		if responseType != "code" || !utils.Contains(payload.GrantTypes, "authorization_code") {
+			return payload, errors.ErrInvalidClientMetadata
+		}
+	}
+
+	if payload.TokenEndpointAuthMethod == "" {
+		payload.TokenEndpointAuthMethod = "client_secret_basic"
+	}
+	if !utils.Contains(SupportedTokenEndpointAuthMethods, payload.TokenEndpointAuthMethod) {
+		return payload, errors.ErrInvalidClientMetadata
+	}
+
+	if payload.Scope == "" {
+		payload.Scope = strings.Join(SupportedScopes, " ")
+	}
+	for _, scope := range strings.Fields(payload.Scope) {
+		if !utils.Contains(SupportedScopes, scope) {
+			return payload, errors.ErrInvalidClientMetadata
+		}
+	}
+	payload.Scope = strings.Join(strings.Fields(payload.Scope), " ")
+
+	return payload, nil
+}
+
+// Authenticate is a function that is used to authenticate the OAuth client with the given credentials,
+// public clients do not have a secret and are only identified
+func (Client) Authenticate(h *initialize.H, clientID, clientSecret string) (models.OAuthClient, error) {
+	client, err := Client{}.Get(h, clientID)
+	if err != nil {
+		return models.OAuthClient{}, err
+	}
+
+	if client.ClientSecret == "" {
+		if clientSecret != "" {
+			return models.OAuthClient{}, errors.ErrInvalidClient
+		}
+
+		return client, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(utils.Hash(clientSecret))) != 1 {
+		return models.OAuthClient{}, errors.ErrInvalidClient
+	}
+
+	return client, nil
+}
+
+// IsGrantTypeAllowed is a function that is used to check wether the client is registered to use the given grant type
+func (Client) IsGrantTypeAllowed(client models.OAuthClient, grantType string) bool {
+	return utils.Contains(strings.Fields(client.GrantTypes), grantType)
+}
+
+// IsRedirectURIAllowed is a function that is used to check wether the given redirect URI is registered
+// with the client, the redirect URI must exactly match one of the registered ones
+func (Client) IsRedirectURIAllowed(client models.OAuthClient, redirectURI string) bool {
+	if redirectURI == "" {
+		return false
+	}
+
+	return utils.Contains(strings.Fields(client.RedirectURIs), redirectURI)
+}
+
+// AllowedScope is a function that is used to check wether the client is allowed to request the given
+// space separated scopes, the scopes are returned without the duplicates
+func (Client) AllowedScope(client models.OAuthClient, scope string) (string, error) {
+	allowed := strings.Fields(client.Scopes)
+
+	scopes := []string{}
+	for _, s := range strings.Fields(scope) {
+		if !utils.Contains(allowed, s) {
+			return "", errors.ErrInvalidScope
+		}
+		if utils.Contains(scopes, s) {
+			continue
+		}
+		scopes = append(scopes, s)
+	}
+
+	return strings.Join(scopes, " "), nil
+}
+
+// isValidRedirectURI is a function that is used to check wether the redirect URI can be registered, only
+// https is allowed except for the loopback addresses and the private use schemes of the native applications
+func isValidRedirectURI(redirectURI string) bool {
+	u, err := url.Parse(redirectURI)
+	if err != nil || u.Scheme == "" || u.Fragment != "" || u.User != nil {
+		return false
+	}
+
+	switch u.Scheme {
+	case "https":
+		return u.Host != ""
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" {
+			return true
+		}
+		ip := net.ParseIP(host)
+		return ip != nil && ip.IsLoopback()
+	case "javascript", "data", "file", "vbscript":
+		return false
+	default:
+		// INFO: Private use schemes must be in the reverse domain name notation (RFC 8252)
+		return strings.Contains(u.Scheme, ".")
+	}
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Consent contains the operations on the scopes that the users allowed the OAuth clients to access
+type Consent struct{}
+
+// IsGranted is a function that is used to check wether the user already allowed the client to access
+// all the given space separated scopes
+func (Consent) IsGranted(h *initialize.H, userID, clientID, scope string) (bool, error) {
+	var consent models.Consent
+	err := h.DB.DB.Where("user_id = ?", userID).Where("client_id = ?", clientID).First(&consent).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	granted := strings.Fields(consent.Scopes)
+	for _, s := range strings.Fields(scope) {
+		if !utils.Contains(granted, s) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// Grant is a function that is used to remember that the user allowed the client to access the given
+// space separated scopes, the scopes are added to the scopes that were granted before
+func (Consent) Grant(h *initialize.H, userID, clientID, scope string) error {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return err
+	}
+
+	return h.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var consent models.Consent
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).
+			Where("client_id = ?", clientID).
+			First(&consent).Error
+		if err == gorm.ErrRecordNotFound {
+			return tx.Omit("Client").Create(&models.Consent{
+				UserID:   uid,
+				ClientID: clientID,
+				Scopes:   strings.Join(strings.Fields(scope), " "),
+			}).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		scopes := strings.Fields(consent.Scopes)
+		for _, s := range strings.Fields(scope) {
+			if !utils.Contains(scopes, s) {
+				scopes = append(scopes, s)
+			}
+		}
+
+		return tx.Model(&models.Consent{}).Where("id = ?", consent.ID).Updates(map[string]interface{}{
+			"scopes":     strings.Join(scopes, " "),
+			"updated_at": time.Now(),
+		}).Error
+	})
+}
+
+// List is a function that is used to list the clients that the user gave consent to along with the scopes
+func (Consent) List(h *initialize.H, userID string) (consents []models.Consent, err error) {
+	err = h.DB.DB.Preload("Client").Where("user_id = ?", userID).Order("granted_at").Find(&consents).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return consents, nil
+}
+
+// Revoke is a function that is used to revoke the tokens that were issued to the client on behalf of the
+// user and to remove the consent that the user gave to the client, the tokens are revoked first so that a
+// failure never leaves tokens of a removed consent behind
+func (Consent) Revoke(h *initialize.H, userID, clientID string) error {
+	var sessions int64
+	err := h.DB.DB.Model(&models.Sessions{}).Where("client_id = ?", clientID).Where("user_id = ?", userID).Count(&sessions).Error
+	if err != nil {
+		return err
+	}
+
+	err = utils.Token{}.DeleteClientTokens(h, clientID, userID)
+	if err != nil {
+		return err
+	}
+
+	result := h.DB.DB.Where("user_id = ?", userID).Where("client_id = ?", clientID).Delete(&models.Consent{})
+	if result.Error != nil {
+		return result.Error
+	}
+
+	// INFO: The tokens can be revoked even when there is no consent (the consent was removed already)
+	if result.RowsAffected == 0 && sessions == 0 {
+		return errors.ErrConsentNotFound
+	}
+
+	return nil
+}
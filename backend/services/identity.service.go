@@ -0,0 +1,192 @@
+package services
+
+import (
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Identity contains the operations on the provider accounts that are linked to the users
+type Identity struct{}
+
+// GetUser is a function that is used to get the user that the given provider account is linked to
+func (Identity) GetUser(h *initialize.H, provider, providerID string) (user models.User, err error) {
+	err = h.DB.DB.
+		Joins("JOIN identities ON identities.user_id = users.id").
+		Where("identities.provider = ?", provider).
+		Where("identities.provider_id = ?", providerID).
+		First(&user).Error
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// List is a function that is used to list the provider accounts that are linked to the user
+func (Identity) List(h *initialize.H, userID string) (identities []models.Identity, err error) {
+	err = h.DB.DB.Where("user_id = ?", userID).Order("created_at").Find(&identities).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// Link is a function that is used to link the given provider account to the user
+func (Identity) Link(h *initialize.H, userID string, profile schemas.BasicOAuthProvider, provider string) (identity models.Identity, err error) {
+	uid, err := uuid.Parse(userID)
+	if err != nil {
+		return models.Identity{}, err
+	}
+
+	err = h.DB.DB.Where("provider = ?", provider).Where("provider_id = ?", profile.ID).First(&identity).Error
+	if err == nil {
+		if identity.UserID != uid {
+			return models.Identity{}, errors.ErrIdentityAlreadyLinked
+		}
+
+		return identity, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return models.Identity{}, err
+	}
+
+	identity = models.Identity{
+		UserID:     uid,
+		Provider:   provider,
+		ProviderID: profile.ID,
+	}
+	if profile.Email != nil {
+		identity.Email = *profile.Email
+	}
+
+	err = h.DB.DB.Create(&identity).Error
+	if err != nil {
+		if ok := (errors.CheckDBError{}.DuplicateKey(err)); ok {
+			return models.Identity{}, errors.ErrProviderAlreadyLinked
+		}
+
+		return models.Identity{}, err
+	}
+
+	return identity, nil
+}
+
+// Unlink is a function that is used to unlink the provider account from the user, the provider account
+// cannot be unlinked when the user would not have another way to sign in to the account
+func (Identity) Unlink(h *initialize.H, userID, provider string) error {
+	// INFO: The directory decides who the staff are, so the directory account is never unlinked
+	if provider == models.LDAPProvider {
+		return errors.ErrDirectoryIdentity
+	}
+
+	return h.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var user models.User
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Select("id", "password", "provider", "verified").First(&user, "id = ?", userID).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.ErrUnauthorized
+			}
+
+			return err
+		}
+
+		var identities []models.Identity
+		err = tx.Where("user_id = ?", userID).Find(&identities).Error
+		if err != nil {
+			return err
+		}
+
+		found := false
+		for _, identity := range identities {
+			if identity.Provider == provider {
+				found = true
+			}
+		}
+		if !found {
+			return errors.ErrIdentityNotFound
+		}
+
+		if !canSignInWithout(user, identities, provider) {
+			return errors.ErrLastSignInMethod
+		}
+
+		return tx.Where("user_id = ?", userID).Where("provider = ?", provider).Delete(&models.Identity{}).Error
+	})
+}
+
+// canSignInWithout is a function that is used to check wether the user can still sign in to the account
+// once the given provider account is unlinked, with the password, another provider account or the magic
+// links and the one time codes that are sent to the verified email address
+func canSignInWithout(user models.User, identities []models.Identity, provider string) bool {
+	// INFO: The directory users sign in with the directory, the password and the email sign in methods are
+	// not available to them
+	directory := user.Provider != nil && *user.Provider == models.LDAPProvider
+
+	if !directory && user.Password != "" {
+		return true
+	}
+	if !directory && user.Verified != nil && *user.Verified {
+		return true
+	}
+
+	for _, identity := range identities {
+		if identity.Provider != provider {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ConfirmPendingLink is a function that is used to link the provider account once the owner of the email
+// address confirmed it, the email address is verified with User.VerifyByEmail
+func (Identity) ConfirmPendingLink(h *initialize.H, pending schemas.PendingLink) (user models.User, err error) {
+	err = h.DB.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&user, "id = ?", pending.UserID).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.ErrAccountLinkExpired
+			}
+
+			return err
+		}
+
+		// INFO: The email address was changed after the link was requested
+		if user.Email != pending.Email {
+			return errors.ErrAccountLinkExpired
+		}
+
+		identity := models.Identity{
+			UserID:     *user.ID,
+			Provider:   pending.Provider,
+			ProviderID: pending.Profile.ID,
+			Email:      pending.Email,
+		}
+		err = tx.Create(&identity).Error
+		if err != nil {
+			if ok := (errors.CheckDBError{}.DuplicateKey(err)); ok {
+				return errors.ErrIdentityAlreadyLinked
+			}
+
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	err = User{}.VerifyByEmail(h, user.ID.String())
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
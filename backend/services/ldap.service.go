@@ -0,0 +1,107 @@
+package services
+
+import (
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"gorm.io/gorm"
+)
+
+// LDAP contains the operations of the users that log in with the LDAP / Active Directory server
+type LDAP struct{}
+
+// LDAPLogin is a function to login / register the users with the entries of the directory, the users are
+// created just in time on their first login and their role is synced with their groups on every login
+func (LDAP) LDAPLogin(h *initialize.H, directory *config.LDAP, profile schemas.BasicOAuthProvider, groups []string) (user models.User, err error) {
+	role := directory.Role(groups)
+
+	user, err = Identity{}.GetUser(h, models.LDAPProvider, profile.ID)
+	if err == gorm.ErrRecordNotFound {
+		user, err = LDAP{}.relink(h, profile)
+	}
+	if err == nil {
+		if user.Role == nil || *user.Role != role {
+			err = h.DB.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("role", role).Error
+			if err != nil {
+				return models.User{}, err
+			}
+			user.Role = &role
+		}
+
+		return user, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return models.User{}, err
+	}
+
+	// INFO: The local account with the same email address could have been created by anyone, so it is
+	// never taken over by the directory account
+	if profile.Email != nil {
+		_, ok, _, err := User{}.IsEmailAvailable(h, *profile.Email)
+		if err != nil {
+			return models.User{}, err
+		}
+		if !ok {
+			return models.User{}, errors.ErrEmailAlreadyUsed
+		}
+	}
+
+	username, err := User{}.GenerateUsername(h, profile.Username)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	provider := models.LDAPProvider
+	verified := profile.Email != nil
+
+	newUser := models.User{
+		Name:       profile.Name,
+		Username:   username,
+		Role:       &role,
+		Provider:   &provider,
+		ProviderID: profile.ID,
+		Verified:   &verified,
+	}
+
+	identity := models.Identity{
+		Provider:   provider,
+		ProviderID: profile.ID,
+	}
+
+	if profile.Email != nil {
+		newUser.Email = *profile.Email
+		identity.Email = *profile.Email
+	}
+
+	newUser.Identities = []models.Identity{identity}
+
+	return User{}.Create(h, newUser)
+}
+
+// relink is a function that is used to link the directory entry again to the account that was created
+// with it when the identity of the directory is no longer linked to the account, only the accounts that
+// were created with the directory are matched
+func (LDAP) relink(h *initialize.H, profile schemas.BasicOAuthProvider) (user models.User, err error) {
+	match := h.DB.DB.Where("provider_id = ?", profile.ID)
+	if profile.Email != nil {
+		match = match.Or("email = ?", *profile.Email)
+	}
+
+	err = h.DB.DB.Where("provider = ?", models.LDAPProvider).Where(match).First(&user).Error
+	if err != nil {
+		return models.User{}, err
+	}
+
+	_, err = Identity{}.Link(h, user.ID.String(), profile, models.LDAPProvider)
+	if err != nil {
+		if err == errors.ErrProviderAlreadyLinked {
+			return models.User{}, errors.ErrEmailAlreadyUsed
+		}
+
+		return models.User{}, err
+	}
+
+	return user, nil
+}
@@ -1,12 +1,13 @@
 package services
 
 import (
-	"fmt"
+	"strings"
 
 	"github.com/VinukaThejana/auth/backend/errors"
 	"github.com/VinukaThejana/auth/backend/initialize"
 	"github.com/VinukaThejana/auth/backend/models"
 	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
 
@@ -14,101 +15,218 @@ import (
 type GitHub struct{}
 
 func create(h *initialize.H, profile schemas.BasicOAuthProvider, provider string) (newUser models.User, err error) {
-	verified := true
+	newUser, err = User{}.Create(h, newOAuthUser(profile, provider))
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return newUser, nil
+}
+
+// newOAuthUser is a function that is used to build the user (along with the identity) of the provider
+// account, the email address is only verified when the provider verified it
+func newOAuthUser(profile schemas.BasicOAuthProvider, provider string) (newUser models.User) {
+	verified := profile.Email != nil && profile.EmailVerified
 
 	newUser.Name = profile.Name
 	newUser.Username = profile.Username
 	newUser.Verified = &verified
 	newUser.Provider = &provider
 	newUser.ProviderID = profile.ID
+	newUser.AvatarURL = profile.AvatarURL
+	newUser.ProfileURL = profile.ProfileURL
+	newUser.Locale = profile.Locale
+
+	identity := models.Identity{
+		Provider:   provider,
+		ProviderID: profile.ID,
+	}
 
 	if profile.Email != nil {
 		newUser.Email = *profile.Email
+		identity.Email = *profile.Email
 	}
 
-	newUser, err = User{}.Create(h, newUser)
-	if err != nil {
-		return models.User{}, err
-	}
+	// INFO: The identity is created along with the user in the same transaction
+	newUser.Identities = []models.Identity{identity}
 
-	return newUser, nil
+	return newUser
 }
 
 // GitHubOAuth is a function to login / register users with GitHub accounts
 func (GitHub) GitHubOAuth(h *initialize.H, profile schemas.GitHub) (user models.User, err error) {
-	provider := models.GitHubProvider
+	return oauth(h, profile.ToBasicOAuthProvider(), models.GitHubProvider)
+}
 
-	err = h.DB.DB.Where("provider = ?", models.GitHubProvider).Where("provider_id = ?", fmt.Sprint(profile.ID)).First(&user).Error
-	if err != nil {
-		if err != gorm.ErrRecordNotFound {
-			return models.User{}, err
-		}
+// Apple contains all Sign in with Apple related OAuth operations
+type Apple struct{}
 
-		if profile.Email == nil {
-			ok, err := User{}.IsUsernameAvailable(h, profile.Username)
+// AppleOAuth is a function to login / register users with Apple accounts
+func (Apple) AppleOAuth(h *initialize.H, profile schemas.Apple) (user models.User, err error) {
+	provider := models.AppleProvider
+
+	user, err = Identity{}.GetUser(h, provider, profile.ID)
+	if err == nil {
+		// INFO: Apple only sends the name on the first login, so store it if it was not stored before
+		if profile.Name != "" && user.Name == user.Username {
+			err = h.DB.DB.Model(&models.User{}).Where("id = ?", user.ID).Update("name", profile.Name).Error
 			if err != nil {
 				return models.User{}, err
 			}
+			user.Name = profile.Name
+		}
 
-			if !ok {
-				// INFO: Prompt the user to choose the username
-				return models.User{}, errors.ErrAddAUsername
-			}
+		return user, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return models.User{}, err
+	}
 
-			user, err = create(h, schemas.BasicOAuthProvider{
-				ID:       fmt.Sprint(profile.ID),
-				Name:     profile.Name,
-				Username: profile.Username,
-				Email:    profile.Email,
-			}, provider)
-			if err != nil {
-				return models.User{}, err
-			}
+	// INFO: Private relay addresses are random, so they are not used to derive the username
+	base := profile.Name
+	if base == "" && profile.Email != nil && !profile.IsPrivateEmail {
+		base, _, _ = strings.Cut(*profile.Email, "@")
+	}
+
+	username, err := User{}.GenerateUsername(h, base)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	name := profile.Name
+	if name == "" {
+		name = username
+	}
+
+	return oauth(h, schemas.BasicOAuthProvider{
+		ID:            profile.ID,
+		Name:          name,
+		Username:      username,
+		Email:         profile.Email,
+		EmailVerified: profile.EmailVerified,
+	}, provider)
+}
+
+// OIDC contains all the generic OpenID Connect related OAuth operations
+type OIDC struct{}
 
-			return user, nil
+// OIDCOAuth is a function to login / register users with the accounts of the given OIDC provider
+func (OIDC) OIDCOAuth(h *initialize.H, profile schemas.BasicOAuthProvider, provider string) (user models.User, err error) {
+	return oauth(h, profile, provider)
+}
+
+// SAML contains all the SAML 2.0 related login operations
+type SAML struct{}
+
+// SAMLLogin is a function to login / register users with the accounts of the given SAML connection, the
+// users are created just in time on their first login
+func (SAML) SAMLLogin(h *initialize.H, profile schemas.BasicOAuthProvider, connection string) (user models.User, err error) {
+	return oauth(h, profile, connection)
+}
+
+// The actions that are taken with the provider account at login
+const (
+	oauthLogin  = "login"
+	oauthLink   = "link"
+	oauthCreate = "create"
+)
+
+// oauthAccounts contains what is known about the accounts of the platform when logging in with the
+// provider account
+type oauthAccounts struct {
+	// Linked is true when the provider account is already linked to a user
+	Linked bool
+	// EmailTaken is true when a local account with the email address of the provider account exists and
+	// EmailVerified is true when that account verified the email address
+	EmailTaken        bool
+	EmailVerified     bool
+	UsernameAvailable bool
+}
+
+// oauthAction is a function that is used to decide what is done with the provider account at login, the
+// errors ask the user to choose a username, to confirm the link by email or to log in another way
+func oauthAction(profile schemas.BasicOAuthProvider, accounts oauthAccounts) (string, error) {
+	if accounts.Linked {
+		return oauthLogin, nil
+	}
+
+	if profile.Email != nil && accounts.EmailTaken {
+		// INFO: An email address that is not verified by the provider could belong to anyone, so it is
+		// never used to link the provider account to an existing account
+		if !profile.EmailVerified {
+			return "", errors.ErrHaveAnAccountWithTheEmail
 		}
 
-		id, ok, verified, err := User{}.IsEmailAvailable(h, *profile.Email)
-		if err != nil {
-			return models.User{}, err
+		if accounts.EmailVerified {
+			return oauthLink, nil
 		}
 
-		if !ok && verified {
-			err := h.DB.DB.Save(&models.User{
-				ID:         id,
-				Provider:   &provider,
-				ProviderID: fmt.Sprint(profile.ID),
-			}).Error
+		// INFO: The owner of the email address must confirm the link by email as the local account
+		// could have been created by someone else with the email address
+		return "", errors.ErrConfirmAccountLink
+	}
+
+	if !accounts.UsernameAvailable {
+		// INFO: Prompt the user to choose the username
+		return "", errors.ErrAddAUsername
+	}
+
+	return oauthCreate, nil
+}
+
+// oauth is a function that is used to login / register users with the profile obtained from the
+// given provider
+func oauth(h *initialize.H, profile schemas.BasicOAuthProvider, provider string) (user models.User, err error) {
+	var accounts oauthAccounts
+
+	user, err = Identity{}.GetUser(h, provider, profile.ID)
+	if err != nil && err != gorm.ErrRecordNotFound {
+		return models.User{}, err
+	}
+	accounts.Linked = err == nil
+
+	var id *uuid.UUID
+	if !accounts.Linked {
+		if profile.Email != nil {
+			var available bool
+			id, available, accounts.EmailVerified, err = User{}.IsEmailAvailable(h, *profile.Email)
 			if err != nil {
-				return models.User{}, nil
+				return models.User{}, err
 			}
+			accounts.EmailTaken = !available
+		}
 
-			user.ID = id
-			err = h.DB.DB.First(&user).Error
+		if !accounts.EmailTaken {
+			accounts.UsernameAvailable, err = User{}.IsUsernameAvailable(h, profile.Username)
 			if err != nil {
 				return models.User{}, err
 			}
-
-			return user, nil
 		}
+	}
+
+	action, err := oauthAction(profile, accounts)
+	if err != nil {
+		return models.User{}, err
+	}
 
-		if !ok {
-			// TODO: Think of the way to handle the scenario where the user email address is available in the database but
-			// not yet verified
-			return models.User{}, fmt.Errorf("FIX ME")
+	switch action {
+	case oauthCreate:
+		return create(h, profile, provider)
+	case oauthLink:
+		_, err = Identity{}.Link(h, id.String(), profile, provider)
+		if err != nil {
+			return models.User{}, err
 		}
 
-		user, err = create(h, schemas.BasicOAuthProvider{
-			ID:       fmt.Sprint(profile.ID),
-			Name:     profile.Name,
-			Username: profile.Username,
-			Email:    profile.Email,
-		}, provider)
+		err = h.DB.DB.First(&user, "id = ?", id).Error
 		if err != nil {
 			return models.User{}, err
 		}
+	}
 
-		return user, nil
+	err = User{}.RefreshProfile(h, &user, profile)
+	if err != nil {
+		return models.User{}, err
 	}
 
 	return user, nil
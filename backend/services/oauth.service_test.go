@@ -0,0 +1,130 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
+)
+
+func TestOAuthAction(t *testing.T) {
+	email := "jane@example.com"
+
+	tests := []struct {
+		name     string
+		profile  schemas.BasicOAuthProvider
+		accounts oauthAccounts
+		action   string
+		err      error
+	}{
+		{
+			name:     "existing identity",
+			profile:  schemas.BasicOAuthProvider{Email: &email, EmailVerified: true},
+			accounts: oauthAccounts{Linked: true, EmailTaken: true},
+			action:   oauthLogin,
+		},
+		{
+			name:     "existing identity with an unverified email",
+			profile:  schemas.BasicOAuthProvider{Email: &email},
+			accounts: oauthAccounts{Linked: true, EmailTaken: true},
+			action:   oauthLogin,
+		},
+		{
+			name:     "new user",
+			profile:  schemas.BasicOAuthProvider{Email: &email, EmailVerified: true},
+			accounts: oauthAccounts{UsernameAvailable: true},
+			action:   oauthCreate,
+		},
+		{
+			name:     "new user without an email",
+			accounts: oauthAccounts{UsernameAvailable: true},
+			action:   oauthCreate,
+		},
+		{
+			name:     "new user with a username that is taken",
+			profile:  schemas.BasicOAuthProvider{Email: &email, EmailVerified: true},
+			accounts: oauthAccounts{},
+			err:      errors.ErrAddAUsername,
+		},
+		{
+			name:     "new user without an email with a username that is taken",
+			accounts: oauthAccounts{},
+			err:      errors.ErrAddAUsername,
+		},
+		{
+			name:     "new user with an unverified provider email",
+			profile:  schemas.BasicOAuthProvider{Email: &email},
+			accounts: oauthAccounts{UsernameAvailable: true},
+			action:   oauthCreate,
+		},
+		{
+			name:     "email collision with a verified local account",
+			profile:  schemas.BasicOAuthProvider{Email: &email, EmailVerified: true},
+			accounts: oauthAccounts{EmailTaken: true, EmailVerified: true},
+			action:   oauthLink,
+		},
+		{
+			name:     "email collision with an unverified local account",
+			profile:  schemas.BasicOAuthProvider{Email: &email, EmailVerified: true},
+			accounts: oauthAccounts{EmailTaken: true},
+			err:      errors.ErrConfirmAccountLink,
+		},
+		{
+			name:     "email collision with an unverified provider email",
+			profile:  schemas.BasicOAuthProvider{Email: &email},
+			accounts: oauthAccounts{EmailTaken: true, EmailVerified: true},
+			err:      errors.ErrHaveAnAccountWithTheEmail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action, err := oauthAction(tt.profile, tt.accounts)
+			if err != tt.err {
+				t.Fatalf("expected the error %v, got %v", tt.err, err)
+			}
+			if action != tt.action {
+				t.Fatalf("expected the action %q, got %q", tt.action, action)
+			}
+		})
+	}
+}
+
+func TestNewOAuthUser(t *testing.T) {
+	email := "jane@example.com"
+
+	tests := []struct {
+		name     string
+		profile  schemas.BasicOAuthProvider
+		verified bool
+	}{
+		{
+			name:     "verified provider email",
+			profile:  schemas.BasicOAuthProvider{ID: "1", Email: &email, EmailVerified: true},
+			verified: true,
+		},
+		{
+			name:     "unverified provider email",
+			profile:  schemas.BasicOAuthProvider{ID: "1", Email: &email},
+			verified: false,
+		},
+		{
+			name:     "no provider email",
+			profile:  schemas.BasicOAuthProvider{ID: "1", EmailVerified: true},
+			verified: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := newOAuthUser(tt.profile, models.GitHubProvider)
+			if *user.Verified != tt.verified {
+				t.Fatalf("expected verified to be %v, got %v", tt.verified, *user.Verified)
+			}
+			if len(user.Identities) != 1 || user.Identities[0].Provider != models.GitHubProvider || user.Identities[0].ProviderID != "1" {
+				t.Fatalf("expected the identity of the provider account, got %+v", user.Identities)
+			}
+		})
+	}
+}
@@ -1,2 +1,6 @@
 // Package services contains db related services
 package services
+
+import "github.com/VinukaThejana/go-utils/logger"
+
+var log logger.Logger
@@ -0,0 +1,181 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// providerTokenRefreshLeeway is the time before the expiry of the provider access token that it is renewed
+const providerTokenRefreshLeeway = 1 * time.Minute
+
+// ProviderToken contains the operations on the tokens that are issued by the providers of the linked accounts
+type ProviderToken struct{}
+
+// Store is a function that is used to encrypt and store the tokens that are issued by the provider
+// with the linked account, nothing is stored when the encryption key is not configured
+func (ProviderToken) Store(h *initialize.H, env *config.Env, provider, providerID string, token *schemas.OAuthToken) error {
+	if env.ProviderTokenEncryptionKey == "" || token == nil || token.AccessToken == "" {
+		return nil
+	}
+
+	return h.DB.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.Identity
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("provider = ?", provider).
+			Where("provider_id = ?", providerID).
+			First(&identity).Error
+		if err != nil {
+			return err
+		}
+
+		return storeProviderToken(tx, env, &identity, token)
+	})
+}
+
+// Get is a function that is used to get a valid access token of the provider for the given user, the
+// access token is renewed with the refresh token of the provider when it is about to expire
+func (ProviderToken) Get(h *initialize.H, env *config.Env, userID, provider string) (*schemas.ProviderToken, error) {
+	if env.ProviderTokenEncryptionKey == "" {
+		return nil, errors.ErrProviderTokenNotFound
+	}
+
+	var token *schemas.ProviderToken
+	err := h.DB.DB.Transaction(func(tx *gorm.DB) error {
+		// INFO: The row is locked so that concurrent requests do not use the same refresh token twice
+		var identity models.Identity
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).
+			Where("provider = ?", provider).
+			First(&identity).Error
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return errors.ErrIdentityNotFound
+			}
+
+			return err
+		}
+
+		if len(identity.AccessToken) == 0 {
+			return errors.ErrProviderTokenNotFound
+		}
+
+		additionalData := providerTokenAdditionalData(&identity)
+
+		if identity.TokenExpiresAt == nil || time.Now().Add(providerTokenRefreshLeeway).Before(*identity.TokenExpiresAt) {
+			accessToken, err := utils.Crypto{}.Decrypt(identity.AccessToken, additionalData, env.ProviderTokenEncryptionKey)
+			if err != nil {
+				return err
+			}
+
+			token = &schemas.ProviderToken{
+				AccessToken: string(accessToken),
+				TokenType:   identity.TokenType,
+				ExpiresAt:   identity.TokenExpiresAt,
+			}
+			return nil
+		}
+
+		if len(identity.RefreshToken) == 0 {
+			return errors.ErrProviderTokenExpired
+		}
+
+		refreshToken, err := utils.Crypto{}.Decrypt(identity.RefreshToken, additionalData, env.ProviderTokenEncryptionKey)
+		if err != nil {
+			return err
+		}
+
+		renewed, err := refreshProviderToken(env, provider, string(refreshToken))
+		if err != nil {
+			return err
+		}
+		if renewed.RefreshToken == "" {
+			renewed.RefreshToken = string(refreshToken)
+		}
+
+		err = storeProviderToken(tx, env, &identity, renewed)
+		if err != nil {
+			return err
+		}
+
+		token = &schemas.ProviderToken{
+			AccessToken: renewed.AccessToken,
+			TokenType:   identity.TokenType,
+			ExpiresAt:   identity.TokenExpiresAt,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// storeProviderToken is a function that is used to encrypt the given tokens and save them with the identity
+func storeProviderToken(tx *gorm.DB, env *config.Env, identity *models.Identity, token *schemas.OAuthToken) error {
+	additionalData := providerTokenAdditionalData(identity)
+
+	accessToken, err := utils.Crypto{}.Encrypt([]byte(token.AccessToken), additionalData, env.ProviderTokenEncryptionKey)
+	if err != nil {
+		return err
+	}
+
+	var refreshToken []byte
+	if token.RefreshToken != "" {
+		refreshToken, err = utils.Crypto{}.Encrypt([]byte(token.RefreshToken), additionalData, env.ProviderTokenEncryptionKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	var expiresAt *time.Time
+	if token.ExpiresIn > 0 {
+		t := time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+		expiresAt = &t
+	}
+
+	identity.AccessToken = accessToken
+	identity.RefreshToken = refreshToken
+	identity.TokenType = token.TokenType
+	identity.TokenExpiresAt = expiresAt
+
+	return tx.Model(&models.Identity{}).Where("id = ?", identity.ID).Updates(map[string]interface{}{
+		"access_token":     accessToken,
+		"refresh_token":    refreshToken,
+		"token_type":       token.TokenType,
+		"token_expires_at": expiresAt,
+		"updated_at":       time.Now(),
+	}).Error
+}
+
+// refreshProviderToken is a function that is used to renew the access token with the provider
+func refreshProviderToken(env *config.Env, provider, refreshToken string) (*schemas.OAuthToken, error) {
+	switch provider {
+	case models.GitHubProvider:
+		return utils.OAuth{}.RefreshGitHubAccessToken(refreshToken, env)
+	case models.AppleProvider:
+		return utils.OAuth{}.RefreshAppleToken(refreshToken, env)
+	default:
+		oidcProvider, ok := env.GetOIDCProvider(provider)
+		if !ok {
+			return nil, errors.ErrProviderNotFound
+		}
+
+		return utils.OIDC{}.RefreshToken(oidcProvider, refreshToken)
+	}
+}
+
+// providerTokenAdditionalData binds the encrypted tokens to the provider account so that they can not be
+// moved to another identity
+func providerTokenAdditionalData(identity *models.Identity) []byte {
+	return []byte(fmt.Sprintf("%s:%s", identity.Provider, identity.ProviderID))
+}
@@ -1,8 +1,16 @@
 package services
 
 import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/VinukaThejana/auth/backend/errors"
 	"github.com/VinukaThejana/auth/backend/initialize"
 	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/VinukaThejana/auth/backend/utils"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 )
@@ -19,7 +27,7 @@ func (User) IsEmailAvailable(h *initialize.H, email string) (id *uuid.UUID, avai
 			return nil, false, false, err
 		}
 
-		return nil, true, false, err
+		return nil, true, false, nil
 	}
 
 	return user.ID, false, *user.Verified, err
@@ -40,6 +48,25 @@ func (User) IsUsernameAvailable(h *initialize.H, username string) (bool, error)
 	return false, nil
 }
 
+// VerifyByEmail is a function that is used to mark the email address of the user as verified once the owner
+// of the address proved that they own it with the magic link, the one time code or the account link
+// confirmation, the password that could have been set by someone else before the address was verified is
+// removed along with the sessions that were created with it
+func (User) VerifyByEmail(h *initialize.H, userID string) error {
+	result := h.DB.DB.Model(&models.User{}).Where("id = ? AND verified = ?", userID, false).Updates(map[string]interface{}{
+		"verified": true,
+		"password": "",
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil
+	}
+
+	return utils.Token{}.DeleteUserTokens(h, userID)
+}
+
 // Create is a function that is used to create a user in the database
 func (User) Create(h *initialize.H, user models.User) (newUser models.User, err error) {
 	newUser = user
@@ -50,3 +77,135 @@ func (User) Create(h *initialize.H, user models.User) (newUser models.User, err
 
 	return newUser, nil
 }
+
+// CreateWithProvider is a function that is used to create a user with the given provider account, used
+// when the user had to choose a username to complete the signup
+func (User) CreateWithProvider(h *initialize.H, profile schemas.BasicOAuthProvider, provider string) (newUser models.User, err error) {
+	return create(h, profile, provider)
+}
+
+// RefreshProfile is a function that is used to update the profile attributes of the user with the ones that
+// are sent by the provider on login, the attributes that the user has overridden are left as they are
+func (User) RefreshProfile(h *initialize.H, user *models.User, profile schemas.BasicOAuthProvider) error {
+	overrides := strings.Fields(user.ProfileOverrides)
+	updates := map[string]interface{}{}
+
+	// INFO: The lengths are the sizes of the columns of the attributes
+	attributes := []struct {
+		name    string
+		value   string
+		current *string
+		length  int
+	}{
+		{models.AvatarURLAttribute, profile.AvatarURL, &user.AvatarURL, 500},
+		{models.ProfileURLAttribute, profile.ProfileURL, &user.ProfileURL, 500},
+		{models.LocaleAttribute, profile.Locale, &user.Locale, 35},
+	}
+	for _, attribute := range attributes {
+		if attribute.value == "" || attribute.value == *attribute.current || utils.Contains(overrides, attribute.name) {
+			continue
+		}
+
+		// INFO: A cut URL or locale is of no use, so the values that are too long are left out instead of
+		// failing the login
+		if utf8.RuneCountInString(attribute.value) > attribute.length {
+			log.Error(fmt.Errorf("the %s of the user %s is longer than %d characters and is not saved", attribute.name, user.ID, attribute.length), nil)
+			continue
+		}
+
+		updates[attribute.name] = attribute.value
+		*attribute.current = attribute.value
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+
+	return h.DB.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error
+}
+
+// UpdateProfile is a function that is used to set the profile attributes of the user, the attributes that
+// are set are no longer refreshed from the providers while the attributes that are set to an empty
+// string are refreshed from the providers again on the next login
+func (User) UpdateProfile(h *initialize.H, userID string, payload schemas.UpdateProfileInput) error {
+	var user models.User
+	if err := h.DB.DB.First(&user, "id = ?", userID).Error; err != nil {
+		return err
+	}
+
+	overrides := strings.Fields(user.ProfileOverrides)
+	updates := map[string]interface{}{}
+	attributes := []struct {
+		name  string
+		value *string
+	}{
+		{models.AvatarURLAttribute, payload.AvatarURL},
+		{models.ProfileURLAttribute, payload.ProfileURL},
+		{models.LocaleAttribute, payload.Locale},
+	}
+	for _, attribute := range attributes {
+		if attribute.value == nil {
+			continue
+		}
+
+		updates[attribute.name] = *attribute.value
+
+		kept := []string{}
+		for _, override := range overrides {
+			if override != attribute.name {
+				kept = append(kept, override)
+			}
+		}
+		if *attribute.value != "" {
+			kept = append(kept, attribute.name)
+		}
+		overrides = kept
+	}
+
+	if len(updates) == 0 {
+		return nil
+	}
+	updates["profile_overrides"] = strings.Join(overrides, " ")
+
+	return h.DB.DB.Model(&models.User{}).Where("id = ?", user.ID).Updates(updates).Error
+}
+
+// GenerateUsername is a function that is used to generate an available username from the given base
+// for users that did not provide a username (Eg :- Sign in with Apple)
+func (User) GenerateUsername(h *initialize.H, base string) (string, error) {
+	var b strings.Builder
+	for _, r := range strings.ToLower(base) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' {
+			b.WriteRune(r)
+		}
+	}
+
+	username := b.String()
+	if len(username) > 15 {
+		username = username[:15]
+	}
+	if len(username) < 3 {
+		username = "user"
+	}
+
+	ok, err := User{}.IsUsernameAvailable(h, username)
+	if err != nil {
+		return "", err
+	}
+	if ok {
+		return username, nil
+	}
+
+	for i := 0; i < 5; i++ {
+		candidate := fmt.Sprintf("%s%04d", username, rand.Intn(10000))
+		ok, err := User{}.IsUsernameAvailable(h, candidate)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return candidate, nil
+		}
+	}
+
+	return "", errors.ErrAddAUsername
+}
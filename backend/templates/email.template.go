@@ -1,34 +1,80 @@
 package templates
 
 import (
-	"bytes"
-	"text/template"
+	"fmt"
+	"time"
 )
 
 // Email contains all the templates that are related to email
 type Email struct{}
 
-// GetEmailConfirmationTmpl is a function that is used to get the email confirmation template
-func (Email) GetEmailConfirmationTmpl(code string) (emailHTML string, err error) {
-	emailVerification := struct{ Code string }{Code: code}
-
-	tmpl := `
-  <h1>Authentication</h1>
-  <br />
-  <strong>Confirm your email address</strong>
-  <br />
-  <a href="http://localhost:8080/email/confirmation?token={{.Code}}">Click to confirm</a>
-  <br />
-  <br />
-  If you are wondering what is going on please ignore this email
-  `
-	t := template.Must(template.New("emailVerification").Parse(tmpl))
-
-	var buf bytes.Buffer
-	err = t.Execute(&buf, emailVerification)
-	if err != nil {
-		return "", err
-	}
+// GetEmailConfirmationTmpl is a function that is used to get the email that asks the user to confirm the
+// email address with the given link or code, the code is optional
+func (Email) GetEmailConfirmationTmpl(link, code string, expiresIn time.Duration) (Rendered, error) {
+	return render("confirmation", struct {
+		Link      string
+		Code      string
+		ExpiresIn string
+	}{Link: link, Code: code, ExpiresIn: formatDuration(expiresIn)})
+}
+
+// GetAccountLinkConfirmationTmpl is a function that is used to get the email that asks the owner of the
+// email address to confirm linking the provider account
+func (Email) GetAccountLinkConfirmationTmpl(link, provider string) (Rendered, error) {
+	return render("account_link", struct {
+		Link     string
+		Provider string
+	}{Link: link, Provider: provider})
+}
 
-	return buf.String(), nil
+// GetPasswordResetTmpl is a function that is used to get the email with the link to reset the password
+func (Email) GetPasswordResetTmpl(link string, expiresIn time.Duration) (Rendered, error) {
+	return render("password_reset", struct {
+		Link      string
+		ExpiresIn string
+	}{Link: link, ExpiresIn: formatDuration(expiresIn)})
+}
+
+// GetMagicLinkTmpl is a function that is used to get the email with the link that logs the user in
+func (Email) GetMagicLinkTmpl(link string, expiresIn time.Duration) (Rendered, error) {
+	return render("magic_link", struct {
+		Link      string
+		ExpiresIn string
+	}{Link: link, ExpiresIn: formatDuration(expiresIn)})
+}
+
+// GetLoginCodeTmpl is a function that is used to get the email with the one time code that logs the user in
+func (Email) GetLoginCodeTmpl(code string, expiresIn time.Duration) (Rendered, error) {
+	return render("login_code", struct {
+		Code      string
+		ExpiresIn string
+	}{Code: code, ExpiresIn: formatDuration(expiresIn)})
+}
+
+// GetNotificationTmpl is a function that is used to get the email that notifies the user of a change to
+// the account (password changed ...), the link is optional
+func (Email) GetNotificationTmpl(title, message, link string) (Rendered, error) {
+	return render("notification", struct {
+		Title   string
+		Message string
+		Link    string
+	}{Title: title, Message: message, Link: link})
+}
+
+// formatDuration is a function that is used to format the expiration time of the links for the emails
+func formatDuration(d time.Duration) string {
+	switch {
+	case d >= time.Hour && d%time.Hour == 0:
+		if d == time.Hour {
+			return "1 hour"
+		}
+		return fmt.Sprintf("%d hours", d/time.Hour)
+	case d >= time.Minute:
+		if d < 2*time.Minute {
+			return "1 minute"
+		}
+		return fmt.Sprintf("%d minutes", d/time.Minute)
+	default:
+		return fmt.Sprintf("%d seconds", d/time.Second)
+	}
 }
@@ -1,2 +1,149 @@
 // Package templates is a package that contains various templates that are used for various purposes
 package templates
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	htmlTemplate "html/template"
+	"io/fs"
+	"os"
+	"path"
+	"strings"
+	textTemplate "text/template"
+)
+
+// emailFS contains the default templates of the emails, every email has an HTML (<name>.html) and a text
+// (<name>.txt) template that fill in the layouts (layout.html and layout.txt), the subject is defined in
+// the text template
+//
+//go:embed emails
+var emailFS embed.FS
+
+var emailNames = []string{"confirmation", "account_link", "password_reset", "magic_link", "login_code", "notification"}
+
+type emailTemplate struct {
+	html *htmlTemplate.Template
+	text *textTemplate.Template
+}
+
+var registry map[string]emailTemplate
+
+func init() {
+	var err error
+	registry, err = loadEmails(nil)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// Rendered is an email that is rendered from the templates
+type Rendered struct {
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Load is a function that is used to load the templates of the emails again with the files of the given
+// directory taking the place of the default templates with the same name (layout.html, confirmation.txt ...)
+func (Email) Load(dir string) error {
+	emails, err := loadEmails(os.DirFS(dir))
+	if err != nil {
+		return err
+	}
+
+	registry = emails
+	return nil
+}
+
+// loadEmails is a function that is used to parse the templates of all the emails, the files of the override
+// are used before the default templates
+func loadEmails(override fs.FS) (map[string]emailTemplate, error) {
+	read := func(name string) (string, error) {
+		if override != nil {
+			data, err := fs.ReadFile(override, name)
+			if err == nil {
+				return string(data), nil
+			}
+			if !errors.Is(err, fs.ErrNotExist) {
+				return "", err
+			}
+		}
+
+		data, err := fs.ReadFile(emailFS, path.Join("emails", name))
+		return string(data), err
+	}
+
+	layoutHTML, err := read("layout.html")
+	if err != nil {
+		return nil, err
+	}
+	layoutText, err := read("layout.txt")
+	if err != nil {
+		return nil, err
+	}
+
+	emails := map[string]emailTemplate{}
+	for _, name := range emailNames {
+		html, err := read(name + ".html")
+		if err != nil {
+			return nil, err
+		}
+		text, err := read(name + ".txt")
+		if err != nil {
+			return nil, err
+		}
+
+		h, err := htmlTemplate.New(name + ".html").Parse(layoutHTML)
+		if err == nil {
+			_, err = h.Parse(html)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		t, err := textTemplate.New(name + ".txt").Parse(layoutText)
+		if err == nil {
+			_, err = t.Parse(text)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if t.Lookup("subject") == nil {
+			return nil, errors.New(name + ".txt must define the subject")
+		}
+
+		emails[name] = emailTemplate{
+			html: h,
+			text: t,
+		}
+	}
+
+	return emails, nil
+}
+
+// render is a function that is used to render the subject and the HTML and text bodies of the email
+func render(name string, data interface{}) (Rendered, error) {
+	tmpl, ok := registry[name]
+	if !ok {
+		return Rendered{}, errors.New("email template " + name + " is not found")
+	}
+
+	var subject, html, text bytes.Buffer
+	if err := tmpl.text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Rendered{}, err
+	}
+	if err := tmpl.html.Execute(&html, data); err != nil {
+		return Rendered{}, err
+	}
+	if err := tmpl.text.Execute(&text, data); err != nil {
+		return Rendered{}, err
+	}
+
+	return Rendered{
+		Subject: strings.Join(strings.Fields(subject.String()), " "),
+		HTML:    html.String(),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}, nil
+}
@@ -0,0 +1,167 @@
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	applePrivateRelayDomain    = "privaterelay.appleid.com"
+	appleClientSecretExpiresIn = 5 * time.Minute
+)
+
+// GetAppleAuthCodeURL is a function that is used to get the URL of the Sign in with Apple page
+func (OAuth) GetAppleAuthCodeURL(state, nonce string, env *config.Env) string {
+	options := url.Values{
+		"response_type": []string{"code"},
+		"response_mode": []string{"form_post"},
+		"client_id":     []string{env.AppleClientID},
+		"redirect_uri":  []string{env.AppleRedirectURL},
+		"scope":         []string{"name email"},
+		"state":         []string{state},
+		"nonce":         []string{nonce},
+	}
+
+	return fmt.Sprintf("%s/auth/authorize?%s", env.AppleBaseURL, options.Encode())
+}
+
+// GetAppleClientSecret is a function that is used to create the client secret that is needed by
+// Apple, which is a JWT signed with the ES256 private key of the developer account
+func (OAuth) GetAppleClientSecret(env *config.Env) (string, error) {
+	decodedPrivateKey, err := base64.StdEncoding.DecodeString(env.ApplePrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := jwt.ParseECPrivateKeyFromPEM(decodedPrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	claims := jwt.MapClaims{
+		"iss": env.AppleTeamID,
+		"sub": env.AppleClientID,
+		"aud": env.AppleBaseURL,
+		"iat": now.Unix(),
+		"exp": now.Add(appleClientSecretExpiresIn).Unix(),
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = env.AppleKeyID
+
+	return token.SignedString(key)
+}
+
+// GetAppleToken is a function that is used to exchange the authorization code for the tokens
+func (OAuth) GetAppleToken(code string, env *config.Env) (*schemas.OAuthToken, error) {
+	token, err := requestAppleToken(url.Values{
+		"grant_type":   []string{"authorization_code"},
+		"code":         []string{code},
+		"redirect_uri": []string{env.AppleRedirectURL},
+	}, env)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("ID token is not provided")
+	}
+
+	return token, nil
+}
+
+// RefreshAppleToken is a function that is used to renew the access token with the refresh token
+func (OAuth) RefreshAppleToken(refreshToken string, env *config.Env) (*schemas.OAuthToken, error) {
+	return requestAppleToken(url.Values{
+		"grant_type":    []string{"refresh_token"},
+		"refresh_token": []string{refreshToken},
+	}, env)
+}
+
+func requestAppleToken(form url.Values, env *config.Env) (*schemas.OAuthToken, error) {
+	clientSecret, err := OAuth{}.GetAppleClientSecret(env)
+	if err != nil {
+		return nil, err
+	}
+
+	form.Set("client_id", env.AppleClientID)
+	form.Set("client_secret", clientSecret)
+
+	client := http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	res, err := client.PostForm(fmt.Sprintf("%s/auth/token", env.AppleBaseURL), form)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not retrieve the tokens from Apple")
+	}
+
+	var token schemas.OAuthToken
+	if err = json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// GetAppleUser is a function that is used to get the Apple user from the ID token, the user object
+// that is posted to the callback is only sent on the first login and is used to get the name
+func (OAuth) GetAppleUser(idToken, user, nonce string, env *config.Env) (*schemas.Apple, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(
+		idToken,
+		claims,
+		jwksKeyFunc(fmt.Sprintf("%s/auth/keys", env.AppleBaseURL)),
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithIssuer(env.AppleBaseURL),
+		jwt.WithAudience(env.AppleClientID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, fmt.Errorf("Validate : nonce mismatch")
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("Subject is not provided by Apple")
+	}
+
+	profile := schemas.Apple{
+		ID:             sub,
+		EmailVerified:  getBoolClaim(claims["email_verified"]),
+		IsPrivateEmail: getBoolClaim(claims["is_private_email"]),
+	}
+
+	if email, _ := claims["email"].(string); email != "" {
+		profile.Email = &email
+		if strings.HasSuffix(strings.ToLower(email), "@"+applePrivateRelayDomain) {
+			profile.IsPrivateEmail = true
+		}
+	}
+
+	if user != "" {
+		var appleUser schemas.AppleUser
+		if err := json.Unmarshal([]byte(user), &appleUser); err == nil {
+			profile.Name = strings.TrimSpace(fmt.Sprintf("%s %s", appleUser.Name.FirstName, appleUser.Name.LastName))
+		}
+	}
+
+	return &profile, nil
+}
@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/schemas"
+)
+
+const (
+	// authorizationCodeExpirationTime is the time that the OAuth client has to exchange the authorization code
+	authorizationCodeExpirationTime = 1 * time.Minute
+	// consentChallengeExpirationTime is the time that the user has to allow or deny the OAuth client
+	consentChallengeExpirationTime = 10 * time.Minute
+)
+
+// Authorization contains the utilities of the OAuth 2.0 authorization server
+type Authorization struct{}
+
+// CreateCode is a function that is used to create a single use authorization code for the given
+// authorization, only the hash of the code is stored
+func (Authorization) CreateCode(h *initialize.H, details schemas.AuthorizationCode) (string, error) {
+	code, err := RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	val, err := json.Marshal(details)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.TODO()
+	err = h.R.RS.Set(ctx, fmt.Sprintf("oauth_code:%s", Hash(code)), string(val), authorizationCodeExpirationTime).Err()
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ExchangeCode is a function that is used to get the authorization that is referred by the given code,
+// the code can only be used once
+func (Authorization) ExchangeCode(h *initialize.H, code string) (*schemas.AuthorizationCode, error) {
+	if code == "" {
+		return nil, errors.ErrInvalidGrant
+	}
+
+	ctx := context.TODO()
+	val := h.R.RS.GetDel(ctx, fmt.Sprintf("oauth_code:%s", Hash(code))).Val()
+	if val == "" {
+		return nil, errors.ErrInvalidGrant
+	}
+
+	var details schemas.AuthorizationCode
+	if err := json.Unmarshal([]byte(val), &details); err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+// VerifyCodeChallenge is a function that is used to verify the PKCE code verifier against the S256
+// code challenge that was given with the authorization request
+func (Authorization) VerifyCodeChallenge(codeVerifier, codeChallenge string) bool {
+	if len(codeVerifier) < 43 || len(codeVerifier) > 128 {
+		return false
+	}
+
+	return subtle.ConstantTimeCompare([]byte(State{}.CodeChallenge(codeVerifier)), []byte(codeChallenge)) == 1
+}
+
+// CreateConsentChallenge is a function that is used to store the authorization request that is waiting for
+// the consent of the user, the returned challenge refers to it
+func (Authorization) CreateConsentChallenge(h *initialize.H, request schemas.ConsentRequest) (string, error) {
+	challenge, err := RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	val, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.TODO()
+	err = h.R.RS.Set(ctx, fmt.Sprintf("oauth_consent:%s", challenge), string(val), consentChallengeExpirationTime).Err()
+	if err != nil {
+		return "", err
+	}
+
+	return challenge, nil
+}
+
+// GetConsentChallenge is a function that is used to get the authorization request that the challenge refers to
+func (Authorization) GetConsentChallenge(h *initialize.H, challenge string) (*schemas.ConsentRequest, error) {
+	if challenge == "" {
+		return nil, errors.ErrConsentNotFound
+	}
+
+	ctx := context.TODO()
+	val := h.R.RS.Get(ctx, fmt.Sprintf("oauth_consent:%s", challenge)).Val()
+	if val == "" {
+		return nil, errors.ErrConsentNotFound
+	}
+
+	var request schemas.ConsentRequest
+	if err := json.Unmarshal([]byte(val), &request); err != nil {
+		return nil, err
+	}
+
+	return &request, nil
+}
+
+// DeleteConsentChallenge is a function that is used to delete the challenge once the user made a decision,
+// a challenge can only be decided once
+func (Authorization) DeleteConsentChallenge(h *initialize.H, challenge string) error {
+	ctx := context.TODO()
+	deleted, err := h.R.RS.Del(ctx, fmt.Sprintf("oauth_consent:%s", challenge)).Result()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return errors.ErrConsentNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,263 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// DeviceCodeExpirationTime is the time that the user has to approve the device
+	DeviceCodeExpirationTime = 10 * time.Minute
+	// DevicePollingInterval is the minimum number of seconds between the token requests of the device
+	DevicePollingInterval = 5
+	// deviceCodeIssuedTime is the time that a device code is remembered after it expires so that the
+	// expired device codes can be told apart from the device codes that were never issued
+	deviceCodeIssuedTime = 24 * time.Hour
+	// userCodeCharset contains the characters of the user codes, the vowels and the look alike characters
+	// are left out so that the codes are easy to type and do not form words
+	userCodeCharset = "BCDFGHJKLMNPQRSTVWXZ"
+)
+
+const (
+	//revive:disable
+	DevicePending  = "pending"
+	DeviceApproved = "approved"
+	DeviceDenied   = "denied"
+	//revive:enable
+)
+
+// devicePollScript records the time of the poll and increases the polling interval of the device when it
+// polls faster than the interval, it returns 1 when the device must slow down
+var devicePollScript = redis.NewScript(`
+local last = tonumber(redis.call("HGET", KEYS[1], "last_polled_at"))
+local interval = tonumber(redis.call("HGET", KEYS[1], "interval")) or tonumber(ARGV[2])
+local now = tonumber(ARGV[1])
+local slowDown = 0
+if last and now - last < interval then
+	interval = interval + tonumber(ARGV[2])
+	slowDown = 1
+end
+redis.call("HSET", KEYS[1], "last_polled_at", now, "interval", interval)
+redis.call("EXPIRE", KEYS[1], ARGV[3])
+return slowDown
+`)
+
+// Device contains the utilities of the device authorization grant (RFC 8628)
+type Device struct{}
+
+// CreateCode is a function that is used to create the device code and the user code of a device
+// authorization request
+func (Device) CreateCode(h *initialize.H, clientID, scope string) (deviceCode, userCode string, err error) {
+	deviceCode, err = RandomString(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	userCode, err = randomUserCode()
+	if err != nil {
+		return "", "", err
+	}
+
+	val, err := json.Marshal(schemas.DeviceAuthorization{
+		ClientID: clientID,
+		Scope:    scope,
+		UserCode: userCode,
+		Status:   DevicePending,
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	ctx := context.TODO()
+	ok, err := h.R.RS.SetNX(ctx, fmt.Sprintf("device_user_code:%s", userCode), Hash(deviceCode), DeviceCodeExpirationTime).Result()
+	if err != nil {
+		return "", "", err
+	}
+	if !ok {
+		return "", "", fmt.Errorf("User code collision")
+	}
+
+	_, err = h.R.RS.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(ctx, fmt.Sprintf("device_code:%s", Hash(deviceCode)), string(val), DeviceCodeExpirationTime)
+		pipe.Set(ctx, fmt.Sprintf("device_code_issued:%s", Hash(deviceCode)), 1, deviceCodeIssuedTime)
+		return nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return deviceCode, FormatUserCode(userCode), nil
+}
+
+// GetByUserCode is a function that is used to get the pending device authorization request that the
+// user code that is entered by the user refers to
+func (Device) GetByUserCode(h *initialize.H, userCode string) (*schemas.DeviceAuthorization, error) {
+	ctx := context.TODO()
+	deviceCodeHash := h.R.RS.Get(ctx, fmt.Sprintf("device_user_code:%s", normalizeUserCode(userCode))).Val()
+	if deviceCodeHash == "" {
+		return nil, errors.ErrInvalidUserCode
+	}
+
+	details, err := getDeviceAuthorization(h, deviceCodeHash)
+	if err != nil {
+		return nil, err
+	}
+	if details.Status != DevicePending {
+		return nil, errors.ErrInvalidUserCode
+	}
+
+	return details, nil
+}
+
+// Decide is a function that is used to approve or deny the device authorization request on behalf of the
+// logged in user, the user code can only be used once
+func (Device) Decide(h *initialize.H, userCode, userID string, authTime int64, approve bool) (*schemas.DeviceAuthorization, error) {
+	ctx := context.TODO()
+	deviceCodeHash := h.R.RS.GetDel(ctx, fmt.Sprintf("device_user_code:%s", normalizeUserCode(userCode))).Val()
+	if deviceCodeHash == "" {
+		return nil, errors.ErrInvalidUserCode
+	}
+
+	details, err := getDeviceAuthorization(h, deviceCodeHash)
+	if err != nil {
+		return nil, err
+	}
+	if details.Status != DevicePending {
+		return nil, errors.ErrInvalidUserCode
+	}
+
+	details.Status = DeviceDenied
+	if approve {
+		details.Status = DeviceApproved
+		details.UserID = userID
+		details.AuthTime = authTime
+	}
+
+	err = setDeviceAuthorization(h, deviceCodeHash, details)
+	if err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
+
+// Poll is a function that is used to check the device authorization request of the given device code when
+// the device asks for the tokens, the approved request is returned only once
+func (Device) Poll(h *initialize.H, deviceCode, clientID string) (*schemas.DeviceAuthorization, error) {
+	deviceCodeHash := Hash(deviceCode)
+
+	details, err := getDeviceAuthorization(h, deviceCodeHash)
+	if err != nil {
+		return nil, err
+	}
+	if details.ClientID != clientID {
+		return nil, errors.ErrInvalidGrant
+	}
+
+	ctx := context.TODO()
+	key := fmt.Sprintf("device_code:%s", deviceCodeHash)
+
+	switch details.Status {
+	case DeviceApproved, DeviceDenied:
+		// INFO: Concurrent requests with the same device code must not get the tokens twice
+		deleted, err := h.R.RS.Del(ctx, key).Result()
+		if err != nil {
+			return nil, err
+		}
+		if deleted == 0 {
+			return nil, errors.ErrExpiredToken
+		}
+
+		if details.Status == DeviceDenied {
+			return nil, errors.ErrAccessDenied
+		}
+
+		return details, nil
+	default:
+		// INFO: The polling state is kept apart from the device authorization request so that a poll can
+		// never write back a stale pending status over the decision of the user
+		slowDown, err := devicePollScript.Run(
+			ctx,
+			h.R.RS,
+			[]string{fmt.Sprintf("device_poll:%s", deviceCodeHash)},
+			time.Now().Unix(),
+			DevicePollingInterval,
+			int64(DeviceCodeExpirationTime.Seconds()),
+		).Int()
+		if err != nil {
+			return nil, err
+		}
+		if slowDown == 1 {
+			return nil, errors.ErrSlowDown
+		}
+
+		return nil, errors.ErrAuthorizationPending
+	}
+}
+
+// FormatUserCode is a function that is used to format the user code so that it is easy to read (XXXX-XXXX)
+func FormatUserCode(userCode string) string {
+	return fmt.Sprintf("%s-%s", userCode[:4], userCode[4:])
+}
+
+func getDeviceAuthorization(h *initialize.H, deviceCodeHash string) (*schemas.DeviceAuthorization, error) {
+	ctx := context.TODO()
+	val := h.R.RS.Get(ctx, fmt.Sprintf("device_code:%s", deviceCodeHash)).Val()
+	if val == "" {
+		issued, err := h.R.RS.Exists(ctx, fmt.Sprintf("device_code_issued:%s", deviceCodeHash)).Result()
+		if err != nil {
+			return nil, err
+		}
+		if issued == 0 {
+			return nil, errors.ErrInvalidGrant
+		}
+
+		return nil, errors.ErrExpiredToken
+	}
+
+	var details schemas.DeviceAuthorization
+	if err := json.Unmarshal([]byte(val), &details); err != nil {
+		return nil, err
+	}
+
+	return &details, nil
+}
+
+func setDeviceAuthorization(h *initialize.H, deviceCodeHash string, details *schemas.DeviceAuthorization) error {
+	val, err := json.Marshal(details)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+	return h.R.RS.SetXX(ctx, fmt.Sprintf("device_code:%s", deviceCodeHash), string(val), redis.KeepTTL).Err()
+}
+
+func randomUserCode() (string, error) {
+	code := make([]byte, 8)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(userCodeCharset))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = userCodeCharset[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+func normalizeUserCode(userCode string) string {
+	userCode = strings.ToUpper(userCode)
+	userCode = strings.ReplaceAll(userCode, "-", "")
+	return strings.ReplaceAll(userCode, " ", "")
+}
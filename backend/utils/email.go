@@ -2,7 +2,9 @@ package utils
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/url"
 	"strings"
 	"time"
 
@@ -10,45 +12,174 @@ import (
 	"github.com/VinukaThejana/auth/backend/errors"
 	"github.com/VinukaThejana/auth/backend/initialize"
 	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/VinukaThejana/auth/backend/schemas"
 	"github.com/VinukaThejana/auth/backend/templates"
 	"github.com/google/uuid"
-	"github.com/resendlabs/resend-go"
 	"gorm.io/gorm"
 )
 
 var (
-	resendEmailFrom                 = "onboarding@resend.dev"
-	resendReplyToEmail              = "onboarding@resend.dev"
 	emailConfirmationExpirationTime = 30 * 60 * time.Second
+	accountLinkExpirationTime       = 30 * 60 * time.Second
 )
 
 // Email is a struct that contains email related functionality
 type Email struct{}
 
-// SendConfirmation is a function that is used to send a confirmation email to the client
-func (Email) SendConfirmation(h *initialize.H, env *config.Env, email, userID string) {
+// SendConfirmation is a function that is used to send a confirmation email to the client through the outbox,
+// the email contains the link and the code that can be entered instead of following the link
+func (Email) SendConfirmation(h *initialize.H, env *config.Env, email, userID string) error {
 	token := uuid.New()
 	ctx := context.TODO()
-	h.R.RE.SetNX(ctx, token.String(), fmt.Sprintf("%s+%s", userID, email), emailConfirmationExpirationTime)
+	err := h.R.RE.SetNX(ctx, token.String(), fmt.Sprintf("%s+%s", userID, email), emailConfirmationExpirationTime).Err()
+	if err != nil {
+		return err
+	}
 
-	emailTemplate, err := templates.Email{}.GetEmailConfirmationTmpl(token.String())
+	code, err := OTP{}.Create(h, env, OTPConfirmation, userID, email, emailConfirmationExpirationTime)
 	if err != nil {
-		log.Error(err, nil)
+		return err
 	}
 
-	client := resend.NewClient(env.ResendAPIKey)
-	params := &resend.SendEmailRequest{
-		From:    resendEmailFrom,
-		To:      []string{email},
-		Html:    emailTemplate,
-		Subject: "Email confirmation",
-		ReplyTo: resendReplyToEmail,
+	emailTemplate, err := templates.Email{}.GetEmailConfirmationTmpl(
+		Email{}.Link(env, "/email/confirmation", url.Values{"token": []string{token.String()}}),
+		code,
+		emailConfirmationExpirationTime,
+	)
+	if err != nil {
+		return err
+	}
+
+	return send(h, email, emailTemplate, emailConfirmationExpirationTime)
+}
+
+// SendAccountLinkConfirmation is a function that is used to ask the owner of the email address to confirm
+// linking the provider account to the local account that is not verified yet
+func (Email) SendAccountLinkConfirmation(h *initialize.H, env *config.Env, pending schemas.PendingLink) error {
+	token := uuid.New()
+
+	val, err := json.Marshal(pending)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+	err = h.R.RE.SetNX(ctx, fmt.Sprintf("link:%s", token.String()), string(val), accountLinkExpirationTime).Err()
+	if err != nil {
+		return err
 	}
-	send, err := client.Emails.Send(params)
+
+	emailTemplate, err := templates.Email{}.GetAccountLinkConfirmationTmpl(
+		Email{}.Link(env, "/oauth/link/confirm", url.Values{"token": []string{token.String()}}),
+		pending.Provider,
+	)
 	if err != nil {
-		log.Error(err, nil)
+		return err
 	}
-	log.Success(send.Id)
+
+	return send(h, pending.Email, emailTemplate, accountLinkExpirationTime)
+}
+
+// SendPasswordReset is a function that is used to send the email with the single use link to reset the
+// password, nothing is sent when a link was sent to the user less than a minute ago
+func (Email) SendPasswordReset(h *initialize.H, env *config.Env, email, userID string) error {
+	token, ok, err := Password{}.CreateResetToken(h, userID)
+	if err != nil || !ok {
+		return err
+	}
+
+	emailTemplate, err := templates.Email{}.GetPasswordResetTmpl(
+		WithQuery(env.PasswordResetURL, url.Values{"token": []string{token}}),
+		PasswordResetExpirationTime,
+	)
+	if err != nil {
+		return err
+	}
+
+	return send(h, email, emailTemplate, PasswordResetExpirationTime)
+}
+
+// SendMagicLink is a function that is used to send the email with the single use link to log in without
+// the password, the link can only be used from the browser with the given nonce
+func (Email) SendMagicLink(h *initialize.H, env *config.Env, email, userID, nonce string) error {
+	token, err := MagicLink{}.Create(h, userID, nonce)
+	if err != nil {
+		return err
+	}
+
+	emailTemplate, err := templates.Email{}.GetMagicLinkTmpl(
+		Email{}.Link(env, "/auth/magic-link/verify", url.Values{"token": []string{token}}),
+		MagicLinkExpirationTime,
+	)
+	if err != nil {
+		return err
+	}
+
+	return send(h, email, emailTemplate, MagicLinkExpirationTime)
+}
+
+// SendLoginCode is a function that is used to send the email with the one time code that logs the user in
+func (Email) SendLoginCode(h *initialize.H, env *config.Env, email, userID string) error {
+	code, err := OTP{}.Create(h, env, OTPLogin, userID, email, OTPExpirationTime)
+	if err != nil {
+		return err
+	}
+
+	emailTemplate, err := templates.Email{}.GetLoginCodeTmpl(code, OTPExpirationTime)
+	if err != nil {
+		return err
+	}
+
+	return send(h, email, emailTemplate, OTPExpirationTime)
+}
+
+// SendNotification is a function that is used to notify the user of a change that was made to the account
+func (Email) SendNotification(h *initialize.H, email, title, message string) error {
+	emailTemplate, err := templates.Email{}.GetNotificationTmpl(title, message, "")
+	if err != nil {
+		return err
+	}
+
+	return send(h, email, emailTemplate, 0)
+}
+
+// ConfirmAccountLink is a function that is used to get the pending account link of the given token, the
+// token can only be used once
+func (Email) ConfirmAccountLink(h *initialize.H, token string) (*schemas.PendingLink, error) {
+	_, err := uuid.Parse(token)
+	if err != nil {
+		return nil, errors.ErrBadRequest
+	}
+
+	ctx := context.TODO()
+	val := h.R.RE.GetDel(ctx, fmt.Sprintf("link:%s", token)).Val()
+	if val == "" {
+		return nil, errors.ErrAccountLinkExpired
+	}
+
+	var pending schemas.PendingLink
+	err = json.Unmarshal([]byte(val), &pending)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pending, nil
+}
+
+// Link is a function that is used to build the links of the emails from the public URL of this service
+func (Email) Link(env *config.Env, path string, query url.Values) string {
+	return fmt.Sprintf("%s%s?%s", strings.TrimSuffix(env.PublicURL, "/"), path, query.Encode())
+}
+
+// send is a function that is used to enqueue the email in the outbox, the worker delivers it with retries
+// until the links and the codes of the email expire (never when expiresIn is zero)
+func send(h *initialize.H, email string, rendered templates.Rendered, expiresIn time.Duration) error {
+	return Outbox{}.Enqueue(h.DB.DB, initialize.Message{
+		To:      []string{email},
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+	}, expiresIn)
 }
 
 // ConfirmEmail is a function that is used to confirm the email of the user with the provided token
@@ -89,6 +220,26 @@ func (Email) ConfirmEmail(h *initialize.H, token, userID string) error {
 	}
 
 	h.R.RE.Del(ctx, token)
+	_ = OTP{}.Delete(h, OTPConfirmation, userID)
+	return nil
+}
+
+// ConfirmEmailWithCode is a function that is used to confirm the email address with the code of the
+// confirmation email instead of the link
+func (Email) ConfirmEmailWithCode(h *initialize.H, env *config.Env, code, userID string) error {
+	email, err := OTP{}.Verify(h, env, OTPConfirmation, userID, code)
+	if err != nil {
+		return err
+	}
+
+	result := h.DB.DB.Model(&models.User{}).Where("id = ?", userID).Where("email = ?", email).Update("verified", true)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.ErrUnauthorized
+	}
+
 	return nil
 }
 
@@ -104,6 +255,13 @@ func (Email) ResendConfirmaton(h *initialize.H, env *config.Env, userID string)
 		return err
 	}
 
-	Email{}.SendConfirmation(h, env, user.Email, userID)
-	return nil
+	ok, err := OTP{}.AllowResend(h, OTPConfirmation, userID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.ErrTooManyRequests
+	}
+
+	return Email{}.SendConfirmation(h, env, user.Email, userID)
 }
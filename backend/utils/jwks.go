@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// jwksCacheTTL is the duration that a fetched JWKS is trusted before it is fetched again
+	jwksCacheTTL = 1 * time.Hour
+	// jwksRefetchCooldown is the minimum time between the fetches of the same JWKS, the tokens with a key
+	// ID that is not known can not make the server fetch the JWKS more often than this
+	jwksRefetchCooldown = 1 * time.Minute
+)
+
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+type jwksEntry struct {
+	keys      map[string]interface{}
+	fetchedAt time.Time
+	// attemptedAt is the time of the last fetch of the JWKS whether it succeeded or not
+	attemptedAt time.Time
+}
+
+var (
+	jwksMu    sync.RWMutex
+	jwksCache = map[string]*jwksEntry{}
+)
+
+// getJWKSKey is a function that is used to get the public key with the given key ID from the
+// JWKS that is served at the given URI, the JWKS is cached and only refetched when it is stale
+// or when the key ID is not known (key rotation), at most once every jwksRefetchCooldown
+func getJWKSKey(jwksURI, kid string) (interface{}, error) {
+	jwksMu.RLock()
+	entry, ok := jwksCache[jwksURI]
+	if ok && time.Since(entry.fetchedAt) < jwksCacheTTL {
+		if key, ok := entry.keys[kid]; ok {
+			jwksMu.RUnlock()
+			return key, nil
+		}
+	}
+	jwksMu.RUnlock()
+
+	// INFO: The attempt is claimed under the lock so that the concurrent requests with unknown key IDs
+	// (or a provider that is down) do not fetch the JWKS more than once in the cooldown
+	jwksMu.Lock()
+	entry, ok = jwksCache[jwksURI]
+	if !ok {
+		entry = &jwksEntry{}
+		jwksCache[jwksURI] = entry
+	}
+	if time.Since(entry.attemptedAt) < jwksRefetchCooldown {
+		key, found := entry.keys[kid]
+		jwksMu.Unlock()
+		if !found || time.Since(entry.fetchedAt) >= jwksCacheTTL {
+			return nil, fmt.Errorf("Key %s is not found in the JWKS", kid)
+		}
+
+		return key, nil
+	}
+	entry.attemptedAt = time.Now()
+	jwksMu.Unlock()
+
+	keys, err := fetchJWKS(jwksURI)
+	if err != nil {
+		return nil, err
+	}
+
+	jwksMu.Lock()
+	entry.keys = keys
+	entry.fetchedAt = time.Now()
+	jwksMu.Unlock()
+
+	key, ok := keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("Key %s is not found in the JWKS", kid)
+	}
+
+	return key, nil
+}
+
+// jwksKeyFunc is a function that returns a jwt.Keyfunc that resolves the signing key from the JWKS
+func jwksKeyFunc(jwksURI string) jwt.Keyfunc {
+	return func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return getJWKSKey(jwksURI, kid)
+	}
+}
+
+func fetchJWKS(jwksURI string) (map[string]interface{}, error) {
+	client := http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	res, err := client.Get(jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to fetch the JWKS")
+	}
+
+	var payload struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.NewDecoder(res.Body).Decode(&payload); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{}
+	for _, k := range payload.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (k jwk) publicKey() (interface{}, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("Unsupported curve : %s", k.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+
+		return &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unsupported key type : %s", k.Kty)
+	}
+}
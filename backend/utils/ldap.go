@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"crypto/tls"
+	"encoding/hex"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAP contains the utilities that are used to log the users in with the LDAP / Active Directory server
+type LDAP struct{}
+
+// Authenticate is a function that is used to find the user with the given username or email address in
+// the directory with the service account and to check the password by binding as the user, the groups
+// that the user is a member of are returned along with the profile
+func (LDAP) Authenticate(directory *config.LDAP, login, password string) (*schemas.BasicOAuthProvider, []string, error) {
+	// INFO: A bind with an empty password is an unauthenticated bind that always succeeds
+	if password == "" {
+		return nil, nil, errors.ErrIncorrectCredentials
+	}
+
+	conn, err := ldap.DialURL(directory.URL, ldap.DialWithDialer(&net.Dialer{
+		Timeout: 10 * time.Second,
+	}))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+
+	if directory.StartTLS {
+		u, err := url.Parse(directory.URL)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = conn.StartTLS(&tls.Config{
+			ServerName: u.Hostname(),
+			MinVersion: tls.VersionTLS12,
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	err = conn.Bind(directory.BindDN, directory.BindPassword)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	attributes := directory.Attributes
+	result, err := conn.Search(ldap.NewSearchRequest(
+		directory.BaseDN,
+		ldap.ScopeWholeSubtree,
+		ldap.NeverDerefAliases,
+		2,
+		10,
+		false,
+		strings.ReplaceAll(directory.UserFilter, "{username}", ldap.EscapeFilter(login)),
+		[]string{attributes.ID, attributes.Username, attributes.Name, attributes.Email, attributes.Groups},
+		nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, nil, errors.ErrIncorrectCredentials
+		}
+
+		return nil, nil, err
+	}
+
+	if len(result.Entries) == 0 {
+		return nil, nil, errors.ErrDirectoryUserNotFound
+	}
+	// INFO: The username must point to exactly one entry, otherwise the password could be checked
+	// against the wrong entry
+	if len(result.Entries) > 1 {
+		return nil, nil, errors.ErrIncorrectCredentials
+	}
+
+	entry := result.Entries[0]
+	err = conn.Bind(entry.DN, password)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, nil, errors.ErrIncorrectCredentials
+		}
+
+		return nil, nil, err
+	}
+
+	id := ldapID(entry.GetRawAttributeValue(attributes.ID))
+	if id == "" {
+		id = entry.DN
+	}
+
+	profile := schemas.BasicOAuthProvider{
+		ID:            id,
+		Name:          entry.GetAttributeValue(attributes.Name),
+		Username:      entry.GetAttributeValue(attributes.Username),
+		EmailVerified: true,
+	}
+
+	if email := entry.GetAttributeValue(attributes.Email); email != "" {
+		profile.Email = &email
+	}
+
+	if profile.Username == "" && profile.Email != nil {
+		profile.Username, _, _ = strings.Cut(*profile.Email, "@")
+	}
+	if profile.Name == "" {
+		profile.Name = profile.Username
+	}
+
+	return &profile, entry.GetAttributeValues(attributes.Groups), nil
+}
+
+// ldapID is a function that is used to get the ID of the directory entry as a string, the binary IDs
+// (objectGUID of Active Directory) are hex encoded
+func ldapID(value []byte) string {
+	if !utf8.Valid(value) {
+		return hex.EncodeToString(value)
+	}
+
+	for _, r := range string(value) {
+		if !unicode.IsPrint(r) {
+			return hex.EncodeToString(value)
+		}
+	}
+
+	return string(value)
+}
@@ -0,0 +1,311 @@
+package utils
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/models"
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	ldapTestBindDN       = "cn=service,dc=example,dc=com"
+	ldapTestBindPassword = "service-password"
+	ldapTestAdminsGroup  = "cn=admins,ou=groups,dc=example,dc=com"
+)
+
+// ldapTestEntry is an entry of the in-process directory
+type ldapTestEntry struct {
+	dn         string
+	password   string
+	attributes map[string][]string
+}
+
+// ldapTestServer is an in-process stand-in for the directory that answers the bind and the search
+// requests that Authenticate sends, the filters are matched with equality, presence, and, or and not
+type ldapTestServer struct {
+	entries []ldapTestEntry
+}
+
+func newLDAPTestServer(t *testing.T, entries ...ldapTestEntry) string {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+
+	server := &ldapTestServer{entries: entries}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	return "ldap://" + listener.Addr().String()
+}
+
+func (s *ldapTestServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+
+		id := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			code := int64(ldap.LDAPResultInvalidCredentials)
+			if s.bind(op.Children[1].Value.(string), op.Children[2].Data.String()) {
+				code = ldap.LDAPResultSuccess
+			}
+			s.write(conn, id, ldapTestResult(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			base := strings.ToLower(op.Children[0].Value.(string))
+			for _, entry := range s.entries {
+				if strings.HasSuffix(strings.ToLower(entry.dn), base) && matchTestFilter(op.Children[6], entry) {
+					s.write(conn, id, ldapTestSearchEntry(entry))
+				}
+			}
+			s.write(conn, id, ldapTestResult(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		default:
+			return
+		}
+	}
+}
+
+func (s *ldapTestServer) bind(dn, password string) bool {
+	if dn == ldapTestBindDN {
+		return password == ldapTestBindPassword
+	}
+
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.dn, dn) {
+			return password == entry.password
+		}
+	}
+
+	return false
+}
+
+func (s *ldapTestServer) write(conn net.Conn, id int64, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+	packet.AppendChild(op)
+
+	_, _ = conn.Write(packet.Bytes())
+}
+
+func ldapTestResult(tag ber.Tag, code int64) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	result.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+
+	return result
+}
+
+func ldapTestSearchEntry(entry ldapTestEntry) *ber.Packet {
+	result := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	result.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, entry.dn, "Object Name"))
+
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, values := range entry.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attribute.AppendChild(set)
+
+		attributes.AppendChild(attribute)
+	}
+	result.AppendChild(attributes)
+
+	return result
+}
+
+func matchTestFilter(filter *ber.Packet, entry ldapTestEntry) bool {
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchTestFilter(child, entry) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchTestFilter(child, entry) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !matchTestFilter(filter.Children[0], entry)
+	case ldap.FilterPresent:
+		return len(testAttribute(entry, filter.Data.String())) > 0
+	case ldap.FilterEqualityMatch:
+		for _, value := range testAttribute(entry, filter.Children[0].Value.(string)) {
+			if strings.EqualFold(value, filter.Children[1].Value.(string)) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func testAttribute(entry ldapTestEntry, name string) []string {
+	for key, values := range entry.attributes {
+		if strings.EqualFold(key, name) {
+			return values
+		}
+	}
+
+	return nil
+}
+
+func TestLDAPAuthenticate(t *testing.T) {
+	url := newLDAPTestServer(t,
+		ldapTestEntry{
+			dn:       "uid=jane,ou=people,dc=example,dc=com",
+			password: "jane-password",
+			attributes: map[string][]string{
+				"objectClass": {"person"},
+				"entryUUID":   {"5f0c6c2e-8f0a-4c55-9d1e-0a3b7c9d2e11"},
+				"uid":         {"jane"},
+				"cn":          {"Jane Doe"},
+				"mail":        {"jane@example.com"},
+				"memberOf":    {ldapTestAdminsGroup, "cn=staff,ou=groups,dc=example,dc=com"},
+			},
+		},
+		ldapTestEntry{
+			dn:       "uid=john,ou=people,dc=example,dc=com",
+			password: "john-password",
+			attributes: map[string][]string{
+				"objectClass": {"person"},
+				"entryUUID":   {"0d9e7a43-1b6f-4a8e-b2c4-6e5f3a1d7c90"},
+				"uid":         {"john"},
+				"mail":        {"john@example.com"},
+				"memberOf":    {"cn=staff,ou=groups,dc=example,dc=com"},
+			},
+		},
+	)
+
+	directory := &config.LDAP{
+		URL:          url,
+		BindDN:       ldapTestBindDN,
+		BindPassword: ldapTestBindPassword,
+		BaseDN:       "dc=example,dc=com",
+		UserFilter:   "(&(objectClass=person)(|(uid={username})(sAMAccountName={username})(mail={username})))",
+		Attributes: config.LDAPAttributes{
+			ID:       "entryUUID",
+			Username: "uid",
+			Name:     "cn",
+			Email:    "mail",
+			Groups:   "memberOf",
+		},
+		Roles: []config.LDAPRole{
+			{Group: "cn=staff,ou=groups,dc=example,dc=com", Role: models.UserRole},
+			{Group: ldapTestAdminsGroup, Role: models.AdminRole},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		login    string
+		password string
+		err      error
+		id       string
+		username string
+		userName string
+		role     string
+	}{
+		{
+			name:     "bind with the username",
+			login:    "jane",
+			password: "jane-password",
+			id:       "5f0c6c2e-8f0a-4c55-9d1e-0a3b7c9d2e11",
+			username: "jane",
+			userName: "Jane Doe",
+			role:     models.AdminRole,
+		},
+		{
+			name:     "bind with the email address",
+			login:    "john@example.com",
+			password: "john-password",
+			id:       "0d9e7a43-1b6f-4a8e-b2c4-6e5f3a1d7c90",
+			username: "john",
+			userName: "john",
+			role:     models.UserRole,
+		},
+		{
+			name:     "bad password",
+			login:    "jane",
+			password: "john-password",
+			err:      errors.ErrIncorrectCredentials,
+		},
+		{
+			name:     "empty password",
+			login:    "jane",
+			password: "",
+			err:      errors.ErrIncorrectCredentials,
+		},
+		{
+			name:     "user not found",
+			login:    "alice",
+			password: "alice-password",
+			err:      errors.ErrDirectoryUserNotFound,
+		},
+		{
+			name:     "filter injection",
+			login:    "*",
+			password: "jane-password",
+			err:      errors.ErrDirectoryUserNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, groups, err := LDAP{}.Authenticate(directory, tt.login, tt.password)
+			if tt.err != nil {
+				if err != tt.err {
+					t.Fatalf("expected %v, got %v", tt.err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if profile.ID != tt.id || profile.Username != tt.username || profile.Name != tt.userName {
+				t.Fatalf("unexpected profile %+v", profile)
+			}
+			if profile.Email == nil || !profile.EmailVerified {
+				t.Fatalf("expected a verified email address, got %+v", profile)
+			}
+			if role := directory.Role(groups); role != tt.role {
+				t.Fatalf("expected the %s role, got %s", tt.role, role)
+			}
+		})
+	}
+}
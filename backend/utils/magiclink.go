@@ -0,0 +1,118 @@
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+)
+
+const (
+	// MagicLinkExpirationTime is the time that the user has to use the magic link
+	MagicLinkExpirationTime = 10 * time.Minute
+	// magicLinkWindow is the window that the magic link requests are counted in
+	magicLinkWindow = 15 * time.Minute
+	// magicLinkEmailLimit is the number of magic links that can be requested for an email in the window
+	magicLinkEmailLimit = 3
+	// magicLinkIPLimit is the number of magic links that can be requested from an IP address in the window
+	magicLinkIPLimit = 10
+)
+
+// magicLink is the value of the magic link that is stored in Redis, only the hash of the nonce of the
+// browser that requested the link is stored
+type magicLink struct {
+	UserID string `json:"user_id"`
+	Nonce  string `json:"nonce"`
+}
+
+// MagicLink contains the utilities of the passwordless login with the magic links
+type MagicLink struct{}
+
+// Allow is a function that is used to count the magic link request against the limits of the email and
+// the IP address, false is returned when one of the limits is reached
+func (MagicLink) Allow(h *initialize.H, email, ipAddress string) (bool, error) {
+	ctx := context.TODO()
+
+	for _, limit := range []struct {
+		key   string
+		limit int64
+	}{
+		{fmt.Sprintf("magic_link_email:%s", Hash(strings.ToLower(email))), magicLinkEmailLimit},
+		{fmt.Sprintf("magic_link_ip:%s", ipAddress), magicLinkIPLimit},
+	} {
+		ok, err := RateLimit(ctx, h.R.RR, limit.key, limit.limit, magicLinkWindow)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// Create is a function that is used to create the single use token of the magic link that can only be used
+// from the browser with the given nonce, only the hash of the token is stored
+func (MagicLink) Create(h *initialize.H, userID, nonce string) (string, error) {
+	token, err := RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	val, err := json.Marshal(magicLink{
+		UserID: userID,
+		Nonce:  Hash(nonce),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.TODO()
+	err = h.R.RE.Set(ctx, fmt.Sprintf("magic_link:%s", Hash(token)), string(val), MagicLinkExpirationTime).Err()
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// Consume is a function that is used to get the ID of the user that the magic link was issued to, the
+// token can only be used once and only from the browser that requested it
+func (MagicLink) Consume(h *initialize.H, token, nonce string) (string, error) {
+	if token == "" || nonce == "" {
+		return "", errors.ErrMagicLinkExpired
+	}
+
+	ctx := context.TODO()
+	key := fmt.Sprintf("magic_link:%s", Hash(token))
+
+	val := h.R.RE.Get(ctx, key).Val()
+	if val == "" {
+		return "", errors.ErrMagicLinkExpired
+	}
+
+	var link magicLink
+	err := json.Unmarshal([]byte(val), &link)
+	if err != nil {
+		return "", err
+	}
+
+	// INFO: The link is kept when it is opened in another browser (or prefetched by a mail scanner) so that
+	// the user can still use it from the browser that requested it
+	if subtle.ConstantTimeCompare([]byte(link.Nonce), []byte(Hash(nonce))) != 1 {
+		return "", errors.ErrMagicLinkBrowserMismatch
+	}
+
+	deleted, err := h.R.RE.Del(ctx, key).Result()
+	if err != nil {
+		return "", err
+	}
+	if deleted != 1 {
+		return "", errors.ErrMagicLinkExpired
+	}
+
+	return link.UserID, nil
+}
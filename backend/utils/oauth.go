@@ -7,6 +7,7 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/VinukaThejana/auth/backend/config"
@@ -17,17 +18,32 @@ import (
 type OAuth struct{}
 
 // GetGitHubAccessToken is a function that is used to get the access token from GitHub
-func (OAuth) GetGitHubAccessToken(code string, env *config.Env) (accessToken *string, err error) {
+func (OAuth) GetGitHubAccessToken(code, codeVerifier string, env *config.Env) (*schemas.OAuthToken, error) {
+	return getGitHubToken(url.Values{
+		"code":          []string{code},
+		"client_id":     []string{env.GithubClientID},
+		"client_secret": []string{env.GithubClientSecret},
+		"code_verifier": []string{codeVerifier},
+	}, env)
+}
+
+// RefreshGitHubAccessToken is a function that is used to renew the access token with the refresh token, the
+// refresh token is only issued by GitHub apps that have expiring user tokens enabled
+func (OAuth) RefreshGitHubAccessToken(refreshToken string, env *config.Env) (*schemas.OAuthToken, error) {
+	return getGitHubToken(url.Values{
+		"grant_type":    []string{"refresh_token"},
+		"refresh_token": []string{refreshToken},
+		"client_id":     []string{env.GithubClientID},
+		"client_secret": []string{env.GithubClientSecret},
+	}, env)
+}
+
+func getGitHubToken(query url.Values, env *config.Env) (*schemas.OAuthToken, error) {
 	client := http.Client{
 		Timeout: 30 * time.Second,
 	}
 
-	query := url.Values{
-		"code":          []string{code},
-		"client_id":     []string{env.GithubClientID},
-		"client_secret": []string{env.GithubClientSecret},
-	}.Encode()
-	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("https://github.com/login/oauth/access_token?%s", bytes.NewBufferString(query)), nil)
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("%s?%s", env.GithubTokenURL, bytes.NewBufferString(query.Encode())), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -57,13 +73,21 @@ func (OAuth) GetGitHubAccessToken(code string, env *config.Env) (accessToken *st
 		return nil, err
 	}
 
-	token := parsedQuery["access_token"][0]
-	return &token, nil
+	token := &schemas.OAuthToken{
+		AccessToken:  parsedQuery.Get("access_token"),
+		TokenType:    parsedQuery.Get("token_type"),
+		RefreshToken: parsedQuery.Get("refresh_token"),
+	}
+	if expiresIn, err := strconv.ParseInt(parsedQuery.Get("expires_in"), 10, 64); err == nil {
+		token.ExpiresIn = expiresIn
+	}
+
+	return token, nil
 }
 
 // GetGitHubUser is a fucntion to get the GitHub user from the access token provided from github
-func (OAuth) GetGitHubUser(accessToken string) (*schemas.GitHub, error) {
-	req, err := http.NewRequest(http.MethodGet, "https://api.github.com/user", nil)
+func (OAuth) GetGitHubUser(accessToken string, env *config.Env) (*schemas.GitHub, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/user", env.GithubAPIURL), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -94,11 +118,73 @@ func (OAuth) GetGitHubUser(accessToken string) (*schemas.GitHub, error) {
 		return nil, err
 	}
 
-	return &schemas.GitHub{
-		ID:        int(payload["id"].(float64)),
-		Name:      payload["name"].(string),
-		Username:  payload["login"].(string),
-		AvatarURL: payload["avatar_url"].(string),
+	id, ok := payload["id"].(float64)
+	if !ok {
+		return nil, fmt.Errorf("GitHub user ID is not provided")
+	}
+	username, _ := payload["login"].(string)
+	name, _ := payload["name"].(string)
+	if name == "" {
+		name = username
+	}
+	avatarURL, _ := payload["avatar_url"].(string)
+	htmlURL, _ := payload["html_url"].(string)
+
+	user := &schemas.GitHub{
+		ID:        int(id),
+		Name:      name,
+		Username:  username,
+		AvatarURL: avatarURL,
+		HTMLURL:   htmlURL,
 		Email:     schemas.GitHub{}.GetEmailFromPayload(payload),
-	}, nil
+	}
+
+	emails, err := OAuth{}.GetGitHubEmails(accessToken, env)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			primary := email.Email
+			user.Email = &primary
+			user.EmailVerified = true
+			break
+		}
+	}
+
+	return user, nil
+}
+
+// GetGitHubEmails is a function to get the email addresses of the GitHub user, the user:email scope
+// is needed to access the private email addresses
+func (OAuth) GetGitHubEmails(accessToken string, env *config.Env) ([]schemas.GitHubEmail, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/user/emails", env.GithubAPIURL), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	client := http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		err = fmt.Errorf("Failed to fetch the emails from GitHub")
+		return nil, err
+	}
+
+	var emails []schemas.GitHubEmail
+	if err = json.NewDecoder(res.Body).Decode(&emails); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
 }
@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// discoveryCacheTTL is the duration that a fetched discovery document is trusted
+const discoveryCacheTTL = 1 * time.Hour
+
+type discoveryEntry struct {
+	discovery *schemas.OIDCDiscovery
+	fetchedAt time.Time
+}
+
+var (
+	discoveryMu    sync.RWMutex
+	discoveryCache = map[string]*discoveryEntry{}
+)
+
+// OIDC contains generic OpenID Connect related utilities
+type OIDC struct{}
+
+// GetDiscovery is a function that is used to get the discovery document of the given provider
+func (OIDC) GetDiscovery(provider *config.OIDCProvider) (*schemas.OIDCDiscovery, error) {
+	discoveryMu.RLock()
+	entry, ok := discoveryCache[provider.IssuerURL]
+	discoveryMu.RUnlock()
+	if ok && time.Since(entry.fetchedAt) < discoveryCacheTTL {
+		return entry.discovery, nil
+	}
+
+	client := http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	res, err := client.Get(fmt.Sprintf("%s/.well-known/openid-configuration", strings.TrimSuffix(provider.IssuerURL, "/")))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Failed to fetch the discovery document of %s", provider.Name)
+	}
+
+	var discovery schemas.OIDCDiscovery
+	if err = json.NewDecoder(res.Body).Decode(&discovery); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != strings.TrimSuffix(provider.IssuerURL, "/") {
+		return nil, fmt.Errorf("Issuer mismatch in the discovery document of %s", provider.Name)
+	}
+
+	discoveryMu.Lock()
+	discoveryCache[provider.IssuerURL] = &discoveryEntry{
+		discovery: &discovery,
+		fetchedAt: time.Now(),
+	}
+	discoveryMu.Unlock()
+
+	return &discovery, nil
+}
+
+// SupportsPKCE is a function that is used to check wether the provider supports the S256 PKCE method
+func (OIDC) SupportsPKCE(provider *config.OIDCProvider) (bool, error) {
+	discovery, err := OIDC{}.GetDiscovery(provider)
+	if err != nil {
+		return false, err
+	}
+
+	for _, method := range discovery.CodeChallengeMethodsSupported {
+		if method == "S256" {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// GetAuthCodeURL is a function that is used to get the URL that the user must be redirected to
+func (OIDC) GetAuthCodeURL(provider *config.OIDCProvider, state string, details *schemas.OAuthState) (string, error) {
+	discovery, err := OIDC{}.GetDiscovery(provider)
+	if err != nil {
+		return "", err
+	}
+
+	options := url.Values{
+		"response_type": []string{"code"},
+		"client_id":     []string{provider.ClientID},
+		"redirect_uri":  []string{provider.RedirectURL},
+		"scope":         []string{strings.Join(provider.Scopes, " ")},
+		"state":         []string{state},
+		"nonce":         []string{details.Nonce},
+	}
+	if details.CodeVerifier != "" {
+		options.Set("code_challenge", State{}.CodeChallenge(details.CodeVerifier))
+		options.Set("code_challenge_method", "S256")
+	}
+
+	return fmt.Sprintf("%s?%s", discovery.AuthorizationEndpoint, options.Encode()), nil
+}
+
+// ExchangeCode is a function that is used to exchange the authorization code for tokens
+func (OIDC) ExchangeCode(provider *config.OIDCProvider, code, codeVerifier string) (*schemas.OAuthToken, error) {
+	form := url.Values{
+		"grant_type":   []string{"authorization_code"},
+		"code":         []string{code},
+		"redirect_uri": []string{provider.RedirectURL},
+	}
+	if codeVerifier != "" {
+		form.Set("code_verifier", codeVerifier)
+	}
+
+	token, err := requestOIDCToken(provider, form)
+	if err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("ID token is not provided by %s", provider.Name)
+	}
+
+	return token, nil
+}
+
+// RefreshToken is a function that is used to renew the access token of the provider with the refresh token
+func (OIDC) RefreshToken(provider *config.OIDCProvider, refreshToken string) (*schemas.OAuthToken, error) {
+	return requestOIDCToken(provider, url.Values{
+		"grant_type":    []string{"refresh_token"},
+		"refresh_token": []string{refreshToken},
+	})
+}
+
+func requestOIDCToken(provider *config.OIDCProvider, form url.Values) (*schemas.OAuthToken, error) {
+	discovery, err := OIDC{}.GetDiscovery(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	// client_secret_basic is the default when the provider does not advertise the supported methods
+	useBasic := len(discovery.TokenEndpointAuthMethodsSupported) == 0
+	for _, method := range discovery.TokenEndpointAuthMethodsSupported {
+		if method == "client_secret_basic" {
+			useBasic = true
+		}
+	}
+	if !useBasic {
+		form.Set("client_id", provider.ClientID)
+		form.Set("client_secret", provider.ClientSecret)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, discovery.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if useBasic {
+		req.SetBasicAuth(url.QueryEscape(provider.ClientID), url.QueryEscape(provider.ClientSecret))
+	}
+
+	client := http.Client{
+		Timeout: 30 * time.Second,
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Could not retrieve the tokens from %s", provider.Name)
+	}
+
+	var token schemas.OAuthToken
+	if err = json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// VerifyIDToken is a function that is used to verify the ID token issued by the provider
+func (OIDC) VerifyIDToken(provider *config.OIDCProvider, idToken, nonce string) (jwt.MapClaims, error) {
+	discovery, err := OIDC{}.GetDiscovery(provider)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(
+		idToken,
+		claims,
+		jwksKeyFunc(discovery.JwksURI),
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "PS256"}),
+		jwt.WithIssuer(discovery.Issuer),
+		jwt.WithAudience(provider.ClientID),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = claims.GetExpirationTime(); err != nil || claims["exp"] == nil {
+		return nil, fmt.Errorf("Validate : ID token does not expire")
+	}
+
+	if claimNonce, _ := claims["nonce"].(string); claimNonce != nonce {
+		return nil, fmt.Errorf("Validate : nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+// GetUser is a function that is used to get the user profile out of the verified ID token using the
+// claim mapping of the provider
+func (OIDC) GetUser(provider *config.OIDCProvider, token *schemas.OAuthToken, nonce string) (*schemas.BasicOAuthProvider, error) {
+	claims, err := OIDC{}.VerifyIDToken(provider, token.IDToken, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("Subject is not provided by %s", provider.Name)
+	}
+
+	name, _ := claims[provider.Claims.Name].(string)
+	username, _ := claims[provider.Claims.Username].(string)
+	email, _ := claims[provider.Claims.Email].(string)
+	picture, _ := claims[provider.Claims.Picture].(string)
+	profileURL, _ := claims[provider.Claims.Profile].(string)
+	locale, _ := claims[provider.Claims.Locale].(string)
+
+	profile := schemas.BasicOAuthProvider{
+		ID:            sub,
+		Name:          name,
+		Username:      username,
+		EmailVerified: getBoolClaim(claims["email_verified"]),
+		AvatarURL:     picture,
+		ProfileURL:    profileURL,
+		Locale:        locale,
+	}
+
+	if email != "" {
+		profile.Email = &email
+	}
+
+	if profile.Username == "" && profile.Email != nil {
+		profile.Username, _, _ = strings.Cut(*profile.Email, "@")
+	}
+	if profile.Name == "" {
+		profile.Name = profile.Username
+	}
+
+	return &profile, nil
+}
+
+// getBoolClaim is used to read boolean claims as some providers (Apple) send them as strings
+func getBoolClaim(claim interface{}) bool {
+	switch v := claim.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,159 @@
+package utils
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// OTPLogin is the purpose of the codes that are used to log in
+	OTPLogin = "login"
+	// OTPConfirmation is the purpose of the codes that are used to confirm the email address
+	OTPConfirmation = "confirmation"
+
+	// OTPExpirationTime is the time that the user has to enter the login code
+	OTPExpirationTime = 10 * time.Minute
+	// otpMaxAttempts is the number of wrong codes after which the code stops working
+	otpMaxAttempts = 5
+	// otpResendInterval is the minimum time between the codes that are sent to the user
+	otpResendInterval = time.Minute
+	// otpMaxResends is the number of codes that can be sent to the user in otpResendWindow
+	otpMaxResends   = 5
+	otpResendWindow = time.Hour
+	// otpIPLimit is the number of login codes that can be requested from an IP address in otpIPWindow
+	otpIPLimit  = 10
+	otpIPWindow = 15 * time.Minute
+	// otpVerifyIPLimit is the number of codes that can be entered from an IP address in otpIPWindow
+	otpVerifyIPLimit = 20
+)
+
+// otpVerifyScript checks the code and counts the attempt in one step so that concurrent guesses can not get
+// past the attempt limit, the code is removed once it is used or the attempts are used up, it returns the
+// email that the code was sent to, "expired" or "invalid"
+var otpVerifyScript = redis.NewScript(`
+local code = redis.call("HGET", KEYS[1], "code")
+if not code then
+	return "expired"
+end
+local attempts = redis.call("HINCRBY", KEYS[1], "attempts", 1)
+if attempts > tonumber(ARGV[2]) then
+	redis.call("DEL", KEYS[1])
+	return "expired"
+end
+if code ~= ARGV[1] then
+	if attempts == tonumber(ARGV[2]) then
+		redis.call("DEL", KEYS[1])
+		return "expired"
+	end
+	return "invalid"
+end
+local email = redis.call("HGET", KEYS[1], "email")
+redis.call("DEL", KEYS[1])
+return "email:" .. email
+`)
+
+// OTP contains the utilities of the 6 digit one time codes that are sent by email
+type OTP struct{}
+
+// AllowResend is a function that is used to count the code that is about to be sent to the user against
+// the resend limits, false is returned when a code was sent less than a minute ago or too many codes were
+// sent in the last hour
+func (OTP) AllowResend(h *initialize.H, purpose, userID string) (bool, error) {
+	ctx := context.TODO()
+
+	ok, err := h.R.RE.SetNX(ctx, fmt.Sprintf("otp_cooldown:%s:%s", purpose, userID), "true", otpResendInterval).Result()
+	if err != nil || !ok {
+		return false, err
+	}
+
+	return RateLimit(ctx, h.R.RE, fmt.Sprintf("otp_resends:%s:%s", purpose, userID), otpMaxResends, otpResendWindow)
+}
+
+// AllowIP is a function that is used to count the request for a login code against the limit of the IP
+// address, false is returned when the limit is reached
+func (OTP) AllowIP(h *initialize.H, ipAddress string) (bool, error) {
+	return RateLimit(context.TODO(), h.R.RR, fmt.Sprintf("otp_ip:%s", ipAddress), otpIPLimit, otpIPWindow)
+}
+
+// AllowVerifyIP is a function that is used to count the entered code against the limit of the IP address,
+// false is returned when the limit is reached
+func (OTP) AllowVerifyIP(h *initialize.H, ipAddress string) (bool, error) {
+	return RateLimit(context.TODO(), h.R.RR, fmt.Sprintf("otp_verify_ip:%s", ipAddress), otpVerifyIPLimit, otpIPWindow)
+}
+
+// Create is a function that is used to create the code of the user for the given purpose along with the
+// email that it is sent to, the previous code of the user stops working and only the hash is stored
+func (OTP) Create(h *initialize.H, env *config.Env, purpose, userID, email string, expiresIn time.Duration) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	ctx := context.TODO()
+	key := fmt.Sprintf("otp:%s:%s", purpose, userID)
+
+	_, err = h.R.RE.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, "code", otpHash(env, userID, code), "email", email, "attempts", 0)
+		pipe.Expire(ctx, key, expiresIn)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// Verify is a function that is used to check the code of the user for the given purpose and to get the
+// email that it was sent to, the code can only be used once and stops working after too many wrong codes
+func (OTP) Verify(h *initialize.H, env *config.Env, purpose, userID, code string) (string, error) {
+	ctx := context.TODO()
+	key := fmt.Sprintf("otp:%s:%s", purpose, userID)
+
+	val, err := otpVerifyScript.Run(ctx, h.R.RE, []string{key}, otpHash(env, userID, code), otpMaxAttempts).Text()
+	if err != nil {
+		return "", err
+	}
+
+	switch val {
+	case "expired":
+		return "", errors.ErrOTPExpired
+	case "invalid":
+		return "", errors.ErrInvalidOTP
+	default:
+		email, ok := strings.CutPrefix(val, "email:")
+		if !ok {
+			return "", errors.ErrOTPExpired
+		}
+
+		return email, nil
+	}
+}
+
+// Delete is a function that is used to remove the code of the user for the given purpose
+func (OTP) Delete(h *initialize.H, purpose, userID string) error {
+	return h.R.RE.Del(context.TODO(), fmt.Sprintf("otp:%s:%s", purpose, userID)).Err()
+}
+
+// otpHash is a function that is used to get the HMAC of the code that is stored, the ID of the user is
+// part of the HMAC so that the same code of different users does not have the same hash
+func otpHash(env *config.Env, userID, code string) string {
+	mac := hmac.New(sha256.New, []byte(env.OTPSecret))
+	mac.Write([]byte(userID + ":" + code))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
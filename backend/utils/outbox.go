@@ -0,0 +1,274 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// OutboxMaxAttempts is the number of attempts after which the email is moved to the dead letters
+	OutboxMaxAttempts = 8
+	outboxBaseBackoff = 30 * time.Second
+	outboxMaxBackoff  = 2 * time.Hour
+	// outboxLease is the time that the claimed emails are hidden from the other workers while they are sent,
+	// it must be longer than sending the whole batch (outboxBatchSize * initialize.MailerSendTimeout)
+	outboxLease        = 5 * time.Minute
+	outboxPollInterval = 5 * time.Second
+	outboxBatchSize    = 20
+	// outboxRetention is the time that the delivered emails are kept for
+	outboxRetention = 7 * 24 * time.Hour
+)
+
+// Outbox contains the utilities of the outbox that the emails are delivered through, the emails are stored
+// in the database first and are delivered by the worker with retries
+type Outbox struct{}
+
+// Enqueue is a function that is used to store the email in the outbox, the email is delivered by the worker
+// shortly after, pass the transaction to enqueue the email along with the other changes and the time that
+// the links and the codes of the email are valid for (zero when the email does not expire)
+func (Outbox) Enqueue(db *gorm.DB, message initialize.Message, expiresIn time.Duration) error {
+	email := models.OutboxEmail{
+		To:      strings.Join(message.To, " "),
+		Subject: message.Subject,
+		HTML:    message.HTML,
+		Text:    message.Text,
+	}
+	if expiresIn > 0 {
+		expiresAt := time.Now().Add(expiresIn)
+		email.ExpiresAt = &expiresAt
+	}
+
+	return db.Create(&email).Error
+}
+
+// Work is a function that is used to deliver the emails of the outbox until the process exits, more than
+// one worker (instance) can run at the same time
+func (Outbox) Work(h *initialize.H) {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	lastCleanup := time.Time{}
+	for range ticker.C {
+		Outbox{}.work(h, &lastCleanup)
+	}
+}
+
+// work is a function that is used to deliver the due emails and to clean up the outbox once an hour, a
+// panic is recovered so that the worker keeps running
+func (Outbox) work(h *initialize.H, lastCleanup *time.Time) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Error(fmt.Errorf("outbox worker panicked : %v", r), nil)
+		}
+	}()
+
+	for {
+		n, err := Outbox{}.Deliver(h)
+		if err != nil {
+			log.Error(err, nil)
+			break
+		}
+		if n < outboxBatchSize {
+			break
+		}
+	}
+
+	if time.Since(*lastCleanup) > time.Hour {
+		err := h.DB.DB.Where("status = ? AND sent_at < ?", models.OutboxSent, time.Now().Add(-outboxRetention)).Delete(&models.OutboxEmail{}).Error
+		if err != nil {
+			log.Error(err, nil)
+		}
+
+		// INFO: The dead emails are kept for the admins but the tokens in the expired ones are of no use
+		err = h.DB.DB.Model(&models.OutboxEmail{}).Where("expires_at < ? AND (html <> '' OR text <> '')", time.Now()).Updates(map[string]interface{}{
+			"html": "",
+			"text": "",
+		}).Error
+		if err != nil {
+			log.Error(err, nil)
+		}
+
+		*lastCleanup = time.Now()
+	}
+}
+
+// Deliver is a function that is used to send a batch of the emails that are due, the failed emails are
+// retried with exponential backoff and the number of emails that were claimed is returned
+func (Outbox) Deliver(h *initialize.H) (int, error) {
+	var emails []models.OutboxEmail
+
+	// INFO: The emails are claimed with a lease so that the other workers skip them while they are sent
+	err := h.DB.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND next_attempt_at <= ?", models.OutboxPending, time.Now()).
+			Order("next_attempt_at").
+			Limit(outboxBatchSize).
+			Find(&emails).Error
+		if err != nil || len(emails) == 0 {
+			return err
+		}
+
+		ids := make([]*uuid.UUID, 0, len(emails))
+		for _, email := range emails {
+			ids = append(ids, email.ID)
+		}
+
+		return tx.Model(&models.OutboxEmail{}).Where("id IN ?", ids).Update("next_attempt_at", time.Now().Add(outboxLease)).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, email := range emails {
+		if email.ExpiresAt != nil && time.Now().After(*email.ExpiresAt) {
+			err = recordAttempt(h, email, errors.ErrEmailExpired)
+			if err != nil {
+				return len(emails), err
+			}
+			continue
+		}
+
+		sendErr := h.M.Send(initialize.Message{
+			To:      strings.Fields(email.To),
+			Subject: email.Subject,
+			HTML:    email.HTML,
+			Text:    email.Text,
+		})
+
+		err = recordAttempt(h, email, sendErr)
+		if err != nil {
+			return len(emails), err
+		}
+	}
+
+	return len(emails), nil
+}
+
+// recordAttempt is a function that is used to record the result of the attempt to deliver the email and
+// to schedule the next attempt or to move the email to the dead letters, the body is cleared once it is no
+// longer going to be sent
+func recordAttempt(h *initialize.H, email models.OutboxEmail, sendErr error) error {
+	now := time.Now()
+	attempts := email.Attempts + 1
+
+	updates := map[string]interface{}{
+		"attempts":   attempts,
+		"updated_at": now,
+	}
+	attempt := models.OutboxAttempt{
+		EmailID: *email.ID,
+	}
+
+	switch {
+	case sendErr == nil:
+		updates["status"] = models.OutboxSent
+		updates["sent_at"] = now
+		updates["last_error"] = ""
+		updates["html"] = ""
+		updates["text"] = ""
+	case sendErr == errors.ErrEmailExpired:
+		attempt.Error = sendErr.Error()
+		updates["status"] = models.OutboxDead
+		updates["last_error"] = attempt.Error
+		updates["html"] = ""
+		updates["text"] = ""
+	case attempts >= OutboxMaxAttempts:
+		log.Error(sendErr, nil)
+		attempt.Error = sendErr.Error()
+		updates["status"] = models.OutboxDead
+		updates["last_error"] = attempt.Error
+	default:
+		log.Error(sendErr, nil)
+		attempt.Error = sendErr.Error()
+		updates["next_attempt_at"] = now.Add(outboxBackoff(attempts))
+		updates["last_error"] = attempt.Error
+	}
+
+	return h.DB.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Create(&attempt).Error
+		if err != nil {
+			return err
+		}
+
+		return tx.Model(&models.OutboxEmail{}).Where("id = ?", email.ID).Updates(updates).Error
+	})
+}
+
+// outboxBackoff is a function that is used to get the time to wait before the next attempt, it doubles
+// with every attempt (30s, 1m, 2m ...) up to outboxMaxBackoff
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts && backoff < outboxMaxBackoff; i++ {
+		backoff *= 2
+	}
+
+	if backoff > outboxMaxBackoff {
+		return outboxMaxBackoff
+	}
+
+	return backoff
+}
+
+// List is a function that is used to list the emails of the outbox with the given status (all the emails
+// when it is empty), the newest emails first
+func (Outbox) List(h *initialize.H, status string, limit int) (emails []models.OutboxEmail, err error) {
+	query := h.DB.DB.Order("created_at DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	err = query.Find(&emails).Error
+	return emails, err
+}
+
+// Get is a function that is used to get the email of the outbox along with the attempts to deliver it
+func (Outbox) Get(h *initialize.H, id string) (email models.OutboxEmail, err error) {
+	if _, err = uuid.Parse(id); err != nil {
+		return models.OutboxEmail{}, errors.ErrEmailNotFound
+	}
+
+	err = h.DB.DB.Preload("History", func(db *gorm.DB) *gorm.DB {
+		return db.Order("created_at")
+	}).First(&email, "id = ?", id).Error
+	if err == gorm.ErrRecordNotFound {
+		return models.OutboxEmail{}, errors.ErrEmailNotFound
+	}
+
+	return email, err
+}
+
+// Retry is a function that is used to move the dead email back to the outbox, it is sent again right away
+// with a fresh set of attempts, the emails with the links or the codes that have expired are not sent again
+func (Outbox) Retry(h *initialize.H, id string) (models.OutboxEmail, error) {
+	email, err := Outbox{}.Get(h, id)
+	if err != nil {
+		return models.OutboxEmail{}, err
+	}
+
+	if email.Status != models.OutboxDead {
+		return models.OutboxEmail{}, errors.ErrEmailNotDead
+	}
+	if email.ExpiresAt != nil && time.Now().After(*email.ExpiresAt) {
+		return models.OutboxEmail{}, errors.ErrEmailExpired
+	}
+
+	err = h.DB.DB.Model(&models.OutboxEmail{}).Where("id = ? AND status = ?", id, models.OutboxDead).Updates(map[string]interface{}{
+		"status":          models.OutboxPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+		"updated_at":      time.Now(),
+	}).Error
+	if err != nil {
+		return models.OutboxEmail{}, err
+	}
+
+	return Outbox{}.Get(h, id)
+}
@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// PasswordResetExpirationTime is the time that the user has to use the password reset link
+	PasswordResetExpirationTime = 30 * time.Minute
+	// passwordResetInterval is the minimum time between the password reset emails of a user
+	passwordResetInterval = time.Minute
+	// passwordResetWindow is the window that the password reset requests are counted in
+	passwordResetWindow = time.Hour
+	// passwordResetEmailLimit is the number of password resets that can be requested for an email in the window
+	passwordResetEmailLimit = 5
+	// passwordResetIPLimit is the number of password resets that can be requested from an IP address in the window
+	passwordResetIPLimit = 10
+)
+
+// Password contains the utilities that are used to reset the passwords of the users
+type Password struct{}
+
+// AllowReset is a function that is used to count the password reset request against the limits of the
+// email and the IP address, false is returned when one of the limits is reached
+func (Password) AllowReset(h *initialize.H, email, ipAddress string) (bool, error) {
+	ctx := context.TODO()
+
+	for _, limit := range []struct {
+		key   string
+		limit int64
+	}{
+		{fmt.Sprintf("reset_email:%s", Hash(strings.ToLower(email))), passwordResetEmailLimit},
+		{fmt.Sprintf("reset_ip:%s", ipAddress), passwordResetIPLimit},
+	} {
+		ok, err := RateLimit(ctx, h.R.RR, limit.key, limit.limit, passwordResetWindow)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// CreateResetToken is a function that is used to create the single use token of the password reset email,
+// only the hash of the token is stored and the previous token of the user stops working, ok is false when
+// a token was issued to the user less than a minute ago
+func (Password) CreateResetToken(h *initialize.H, userID string) (token string, ok bool, err error) {
+	ctx := context.TODO()
+
+	ok, err = h.R.RE.SetNX(ctx, fmt.Sprintf("reset_throttle:%s", userID), "true", passwordResetInterval).Result()
+	if err != nil || !ok {
+		return "", false, err
+	}
+
+	token, err = RandomString(32)
+	if err != nil {
+		return "", false, err
+	}
+
+	// INFO: The token and the pointer to it are set with their expiry in one step so that neither of them
+	// outlives the other
+	previous, err := h.R.RE.SetArgs(ctx, fmt.Sprintf("reset_user:%s", userID), Hash(token), redis.SetArgs{
+		TTL: PasswordResetExpirationTime,
+		Get: true,
+	}).Result()
+	if err != nil && err != redis.Nil {
+		return "", false, err
+	}
+
+	_, err = h.R.RE.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if previous != "" {
+			pipe.Del(ctx, fmt.Sprintf("reset:%s", previous))
+		}
+		pipe.Set(ctx, fmt.Sprintf("reset:%s", Hash(token)), userID, PasswordResetExpirationTime)
+		return nil
+	})
+	if err != nil {
+		return "", false, err
+	}
+
+	return token, true, nil
+}
+
+// ConsumeResetToken is a function that is used to get the ID of the user that the password reset token
+// was issued to, the token can only be used once
+func (Password) ConsumeResetToken(h *initialize.H, token string) (string, error) {
+	ctx := context.TODO()
+
+	userID := h.R.RE.GetDel(ctx, fmt.Sprintf("reset:%s", Hash(token))).Val()
+	if userID == "" {
+		return "", errors.ErrPasswordResetExpired
+	}
+	h.R.RE.Del(ctx, fmt.Sprintf("reset_user:%s", userID))
+
+	return userID, nil
+}
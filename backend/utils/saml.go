@@ -0,0 +1,301 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/schemas"
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+)
+
+const (
+	// samlClockSkew is the difference between the clocks of the IdP and this service that is tolerated
+	samlClockSkew   = 3 * time.Minute
+	samlPOSTBinding = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlSuccess     = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlBearer      = "urn:oasis:names:tc:SAML:2.0:cm:bearer"
+	samlEmailFormat = "urn:oasis:names:tc:SAML:1.1:nameid-format:emailAddress"
+)
+
+// SAML contains the utilities of the SAML 2.0 service provider (SP)
+type SAML struct{}
+
+// RequestID is a function that is used to get the ID of the authentication request from the nonce of
+// the OAuth state, the ID must not start with a digit
+func (SAML) RequestID(details *schemas.OAuthState) string {
+	return fmt.Sprintf("_%s", details.Nonce)
+}
+
+// GetAuthnRequestURL is a function that is used to get the URL of the IdP that the user must be redirected
+// to with the authentication request (HTTP-Redirect binding)
+func (SAML) GetAuthnRequestURL(connection *config.SAMLConnection, requestID, relayState string) (string, error) {
+	request := schemas.SAMLAuthnRequest{
+		ID:                          requestID,
+		Version:                     "2.0",
+		IssueInstant:                time.Now().UTC().Format(time.RFC3339),
+		Destination:                 connection.IdPSSOURL,
+		ProtocolBinding:             samlPOSTBinding,
+		AssertionConsumerServiceURL: connection.ACSURL,
+		Issuer:                      connection.EntityID,
+	}
+	request.NameIDPolicy.AllowCreate = true
+
+	data, err := xml.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	var b bytes.Buffer
+	w, err := flate.NewWriter(&b, flate.DefaultCompression)
+	if err != nil {
+		return "", err
+	}
+	if _, err = w.Write(data); err != nil {
+		return "", err
+	}
+	if err = w.Close(); err != nil {
+		return "", err
+	}
+
+	return WithQuery(connection.IdPSSOURL, url.Values{
+		"SAMLRequest": []string{base64.StdEncoding.EncodeToString(b.Bytes())},
+		"RelayState":  []string{relayState},
+	}), nil
+}
+
+// GetMetadata is a function that is used to generate the metadata XML of this service (SP) for the given
+// connection
+func (SAML) GetMetadata(connection *config.SAMLConnection) ([]byte, error) {
+	metadata := schemas.SAMLSPMetadata{
+		EntityID: connection.EntityID,
+	}
+	metadata.SPSSODescriptor.AuthnRequestsSigned = false
+	metadata.SPSSODescriptor.WantAssertionsSigned = true
+	metadata.SPSSODescriptor.ProtocolSupportEnumeration = "urn:oasis:names:tc:SAML:2.0:protocol"
+	metadata.SPSSODescriptor.NameIDFormats = []string{
+		samlEmailFormat,
+		"urn:oasis:names:tc:SAML:2.0:nameid-format:persistent",
+	}
+	metadata.SPSSODescriptor.AssertionConsumerService.Binding = samlPOSTBinding
+	metadata.SPSSODescriptor.AssertionConsumerService.Location = connection.ACSURL
+
+	data, err := xml.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ParseResponse is a function that is used to verify the response that is posted by the IdP to the ACS URL
+// and to get the profile of the user out of the signed assertion, the response must be signed or must
+// carry a signed assertion and must answer the authentication request with the given ID
+func (SAML) ParseResponse(connection *config.SAMLConnection, samlResponse, requestID string) (*schemas.BasicOAuthProvider, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(samlResponse), ""))
+	if err != nil {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+
+	doc := etree.NewDocument()
+	if err = doc.ReadFromBytes(data); err != nil || doc.Root() == nil || doc.Root().Tag != "Response" {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+
+	ctx := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{
+		Roots: connection.IdPCertificates,
+	})
+
+	// INFO: Only the elements that are returned by the validation are used so that the signed content
+	// cannot be swapped with unsigned content (XML signature wrapping)
+	root := doc.Root()
+	responseSigned := false
+	if hasSignature(root) {
+		root, err = ctx.Validate(root)
+		if err != nil {
+			return nil, err
+		}
+		responseSigned = true
+	}
+
+	var response schemas.SAMLResponse
+	if err = unmarshalElement(root, &response); err != nil {
+		return nil, err
+	}
+
+	if response.Status.StatusCode.Value != samlSuccess {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+	if response.InResponseTo != requestID {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+	if response.Destination != "" && response.Destination != connection.ACSURL {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+	if response.Issuer != "" && response.Issuer != connection.IdPEntityID {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+
+	// INFO: Encrypted assertions are not supported
+	elements := childElements(root, "Assertion")
+	if len(elements) != 1 {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+
+	// INFO: The assertion is detached along with the namespaces that the IdP declared on the response
+	// so that it is canonicalized the same way that it was signed
+	element, err := detachElement(elements[0])
+	if err != nil {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+	if hasSignature(element) {
+		element, err = ctx.Validate(element)
+		if err != nil {
+			return nil, err
+		}
+	} else if !responseSigned {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+
+	var assertion schemas.SAMLAssertion
+	if err = unmarshalElement(element, &assertion); err != nil {
+		return nil, err
+	}
+
+	if err = validateAssertion(connection, assertion, requestID); err != nil {
+		return nil, err
+	}
+
+	return getSAMLUser(connection, assertion)
+}
+
+// validateAssertion is a function that is used to check that the assertion is issued by the IdP of the
+// connection, to this service and for the given authentication request, and that it is still valid
+func validateAssertion(connection *config.SAMLConnection, assertion schemas.SAMLAssertion, requestID string) error {
+	now := time.Now()
+
+	if assertion.Issuer != connection.IdPEntityID {
+		return errors.ErrInvalidSAMLResponse
+	}
+
+	if assertion.Conditions.NotBefore != "" {
+		notBefore, err := time.Parse(time.RFC3339, assertion.Conditions.NotBefore)
+		if err != nil || now.Add(samlClockSkew).Before(notBefore) {
+			return errors.ErrInvalidSAMLResponse
+		}
+	}
+	if assertion.Conditions.NotOnOrAfter != "" {
+		notOnOrAfter, err := time.Parse(time.RFC3339, assertion.Conditions.NotOnOrAfter)
+		if err != nil || !now.Add(-samlClockSkew).Before(notOnOrAfter) {
+			return errors.ErrInvalidSAMLResponse
+		}
+	}
+
+	audience := false
+	for _, a := range assertion.Conditions.Audiences {
+		if a == connection.EntityID {
+			audience = true
+		}
+	}
+	if !audience {
+		return errors.ErrInvalidSAMLResponse
+	}
+
+	for _, confirmation := range assertion.Subject.SubjectConfirmations {
+		if confirmation.Method != samlBearer {
+			continue
+		}
+
+		if confirmation.Data.Recipient != connection.ACSURL || confirmation.Data.InResponseTo != requestID {
+			continue
+		}
+
+		notOnOrAfter, err := time.Parse(time.RFC3339, confirmation.Data.NotOnOrAfter)
+		if err != nil || !now.Add(-samlClockSkew).Before(notOnOrAfter) {
+			continue
+		}
+
+		return nil
+	}
+
+	return errors.ErrInvalidSAMLResponse
+}
+
+// getSAMLUser is a function that is used to get the profile of the user out of the assertion using the
+// attribute mapping of the connection
+func getSAMLUser(connection *config.SAMLConnection, assertion schemas.SAMLAssertion) (*schemas.BasicOAuthProvider, error) {
+	nameID := strings.TrimSpace(assertion.Subject.NameID.Value)
+	if nameID == "" {
+		return nil, errors.ErrInvalidSAMLResponse
+	}
+
+	email := assertion.Attribute(connection.Attributes.Email)
+	if email == "" && assertion.Subject.NameID.Format == samlEmailFormat {
+		email = nameID
+	}
+
+	profile := schemas.BasicOAuthProvider{
+		ID:            nameID,
+		Name:          assertion.Attribute(connection.Attributes.Name),
+		Username:      assertion.Attribute(connection.Attributes.Username),
+		EmailVerified: connection.TrustEmail,
+	}
+
+	if email != "" {
+		profile.Email = &email
+	}
+
+	if profile.Username == "" && profile.Email != nil {
+		profile.Username, _, _ = strings.Cut(*profile.Email, "@")
+	}
+	if profile.Name == "" {
+		profile.Name = profile.Username
+	}
+
+	return &profile, nil
+}
+
+func hasSignature(el *etree.Element) bool {
+	return len(childElements(el, "Signature")) > 0
+}
+
+func childElements(el *etree.Element, tag string) []*etree.Element {
+	elements := []*etree.Element{}
+	for _, child := range el.ChildElements() {
+		if child.Tag == tag {
+			elements = append(elements, child)
+		}
+	}
+
+	return elements
+}
+
+func detachElement(el *etree.Element) (*etree.Element, error) {
+	ctx, err := etreeutils.NSBuildParentContext(el)
+	if err != nil {
+		return nil, err
+	}
+
+	return etreeutils.NSDetatch(ctx, el)
+}
+
+func unmarshalElement(el *etree.Element, v interface{}) error {
+	doc := etree.NewDocument()
+	doc.SetRoot(el.Copy())
+
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		return err
+	}
+
+	return xml.Unmarshal(data, v)
+}
@@ -0,0 +1,267 @@
+package utils
+
+import (
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/config"
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+)
+
+const (
+	samlTestRequestID = "_3f9a6c1e"
+	samlTestIdP       = "https://idp.example.com/metadata"
+)
+
+// samlTestSigner signs the fixtures as the IdP with a key that is generated for the test
+type samlTestSigner struct {
+	ctx        *dsig.SigningContext
+	connection *config.SAMLConnection
+}
+
+func newSAMLTestSigner(t *testing.T) *samlTestSigner {
+	t.Helper()
+
+	ks := dsig.RandomKeyStoreForTest()
+	_, der, err := ks.GetKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := dsig.NewDefaultSigningContext(ks)
+	ctx.Canonicalizer = dsig.MakeC14N10ExclusiveCanonicalizerWithPrefixList("")
+
+	return &samlTestSigner{
+		ctx: ctx,
+		connection: &config.SAMLConnection{
+			Name:            "okta",
+			EntityID:        "https://auth.example.com/saml/okta",
+			ACSURL:          "https://auth.example.com/oauth/sessions/saml/okta",
+			IdPEntityID:     samlTestIdP,
+			IdPCertificates: []*x509.Certificate{cert},
+			Attributes: config.SAMLAttributes{
+				Name: "name",
+			},
+		},
+	}
+}
+
+// samlTestAssertion contains the values of the assertion fixture that the test cases change
+type samlTestAssertion struct {
+	id           string
+	nameID       string
+	audience     string
+	inResponseTo string
+	notOnOrAfter time.Time
+}
+
+func (s *samlTestSigner) validAssertion() samlTestAssertion {
+	return samlTestAssertion{
+		id:           "_a1",
+		nameID:       "jane@example.com",
+		audience:     s.connection.EntityID,
+		inResponseTo: samlTestRequestID,
+		notOnOrAfter: time.Now().Add(5 * time.Minute),
+	}
+}
+
+func (s *samlTestSigner) assertion(t *testing.T, a samlTestAssertion) *etree.Element {
+	t.Helper()
+
+	notBefore := time.Now().Add(-time.Minute).UTC().Format(time.RFC3339)
+	notOnOrAfter := a.notOnOrAfter.UTC().Format(time.RFC3339)
+
+	return parseTestElement(t, fmt.Sprintf(
+		`<saml:Assertion xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="%s" Version="2.0" IssueInstant="%s">`+
+			`<saml:Issuer>%s</saml:Issuer>`+
+			`<saml:Subject>`+
+			`<saml:NameID Format="%s">%s</saml:NameID>`+
+			`<saml:SubjectConfirmation Method="%s">`+
+			`<saml:SubjectConfirmationData InResponseTo="%s" NotOnOrAfter="%s" Recipient="%s"/>`+
+			`</saml:SubjectConfirmation>`+
+			`</saml:Subject>`+
+			`<saml:Conditions NotBefore="%s" NotOnOrAfter="%s">`+
+			`<saml:AudienceRestriction><saml:Audience>%s</saml:Audience></saml:AudienceRestriction>`+
+			`</saml:Conditions>`+
+			`<saml:AttributeStatement>`+
+			`<saml:Attribute Name="name"><saml:AttributeValue>Jane Doe</saml:AttributeValue></saml:Attribute>`+
+			`</saml:AttributeStatement>`+
+			`</saml:Assertion>`,
+		a.id, notBefore, samlTestIdP,
+		samlEmailFormat, a.nameID,
+		samlBearer, a.inResponseTo, notOnOrAfter, s.connection.ACSURL,
+		notBefore, notOnOrAfter, a.audience,
+	))
+}
+
+func (s *samlTestSigner) response(t *testing.T, inResponseTo string, assertions ...*etree.Element) *etree.Element {
+	t.Helper()
+
+	response := parseTestElement(t, fmt.Sprintf(
+		`<samlp:Response xmlns:samlp="urn:oasis:names:tc:SAML:2.0:protocol" xmlns:saml="urn:oasis:names:tc:SAML:2.0:assertion" ID="_r1" Version="2.0" IssueInstant="%s" Destination="%s" InResponseTo="%s">`+
+			`<saml:Issuer>%s</saml:Issuer>`+
+			`<samlp:Status><samlp:StatusCode Value="%s"/></samlp:Status>`+
+			`</samlp:Response>`,
+		time.Now().UTC().Format(time.RFC3339), s.connection.ACSURL, inResponseTo,
+		samlTestIdP,
+		samlSuccess,
+	))
+	for _, assertion := range assertions {
+		response.AddChild(assertion)
+	}
+
+	return response
+}
+
+func (s *samlTestSigner) sign(t *testing.T, el *etree.Element) *etree.Element {
+	t.Helper()
+
+	signed, err := s.ctx.SignEnveloped(el)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signed
+}
+
+func parseTestElement(t *testing.T, data string) *etree.Element {
+	t.Helper()
+
+	doc := etree.NewDocument()
+	if err := doc.ReadFromString(data); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc.Root()
+}
+
+func encodeTestElement(t *testing.T, el *etree.Element) string {
+	t.Helper()
+
+	doc := etree.NewDocument()
+	doc.SetRoot(el)
+
+	data, err := doc.WriteToBytes()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return base64.StdEncoding.EncodeToString(data)
+}
+
+func TestSAMLParseResponse(t *testing.T) {
+	s := newSAMLTestSigner(t)
+
+	tests := []struct {
+		name     string
+		response func(t *testing.T) *etree.Element
+		ok       bool
+	}{
+		{
+			name: "signed response",
+			response: func(t *testing.T) *etree.Element {
+				return s.sign(t, s.response(t, samlTestRequestID, s.assertion(t, s.validAssertion())))
+			},
+			ok: true,
+		},
+		{
+			name: "signed assertion only",
+			response: func(t *testing.T) *etree.Element {
+				return s.response(t, samlTestRequestID, s.sign(t, s.assertion(t, s.validAssertion())))
+			},
+			ok: true,
+		},
+		{
+			name: "namespaces declared only on the response",
+			response: func(t *testing.T) *etree.Element {
+				assertion := s.sign(t, s.assertion(t, s.validAssertion()))
+				assertion.RemoveAttr("xmlns:saml")
+				return s.response(t, samlTestRequestID, assertion)
+			},
+			ok: true,
+		},
+		{
+			name: "unsigned",
+			response: func(t *testing.T) *etree.Element {
+				return s.response(t, samlTestRequestID, s.assertion(t, s.validAssertion()))
+			},
+		},
+		{
+			name: "signature wrapping",
+			response: func(t *testing.T) *etree.Element {
+				evil := s.validAssertion()
+				evil.id = "_a2"
+				evil.nameID = "admin@example.com"
+				return s.response(t, samlTestRequestID, s.assertion(t, evil), s.sign(t, s.assertion(t, s.validAssertion())))
+			},
+		},
+		{
+			name: "tampered signed assertion",
+			response: func(t *testing.T) *etree.Element {
+				assertion := s.sign(t, s.assertion(t, s.validAssertion()))
+				assertion.FindElement("./Subject/NameID").SetText("admin@example.com")
+				return s.response(t, samlTestRequestID, assertion)
+			},
+		},
+		{
+			name: "wrong audience",
+			response: func(t *testing.T) *etree.Element {
+				a := s.validAssertion()
+				a.audience = "https://other.example.com"
+				return s.response(t, samlTestRequestID, s.sign(t, s.assertion(t, a)))
+			},
+		},
+		{
+			name: "expired",
+			response: func(t *testing.T) *etree.Element {
+				a := s.validAssertion()
+				a.notOnOrAfter = time.Now().Add(-10 * time.Minute)
+				return s.response(t, samlTestRequestID, s.sign(t, s.assertion(t, a)))
+			},
+		},
+		{
+			name: "response to another request",
+			response: func(t *testing.T) *etree.Element {
+				return s.sign(t, s.response(t, "_other", s.assertion(t, s.validAssertion())))
+			},
+		},
+		{
+			name: "assertion for another request",
+			response: func(t *testing.T) *etree.Element {
+				a := s.validAssertion()
+				a.inResponseTo = "_other"
+				return s.response(t, samlTestRequestID, s.sign(t, s.assertion(t, a)))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile, err := SAML{}.ParseResponse(s.connection, encodeTestElement(t, tt.response(t)), samlTestRequestID)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("expected the response to be rejected, got %+v", profile)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("expected the response to be accepted, got %v", err)
+			}
+			if profile.ID != "jane@example.com" || profile.Email == nil || *profile.Email != "jane@example.com" {
+				t.Fatalf("unexpected profile %+v", profile)
+			}
+			if profile.Name != "Jane Doe" {
+				t.Fatalf("expected the name from the attributes, got %q", profile.Name)
+			}
+		})
+	}
+}
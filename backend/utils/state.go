@@ -0,0 +1,126 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/VinukaThejana/auth/backend/errors"
+	"github.com/VinukaThejana/auth/backend/initialize"
+	"github.com/VinukaThejana/auth/backend/schemas"
+)
+
+// oauthStateExpirationTime is the time that the user has to complete the OAuth flow
+const oauthStateExpirationTime = 10 * time.Minute
+
+// State contains the utilities that are used to protect the OAuth redirect flow (state and PKCE)
+type State struct{}
+
+// Create is a function that is used to create a random, single use state for the given provider, the
+// returned binding must be set as a cookie in the browser that started the flow
+func (State) Create(h *initialize.H, provider, returnTo, linkUserID string, pkce bool) (state, binding string, details *schemas.OAuthState, err error) {
+	state, err = RandomString(32)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	binding, err = RandomString(32)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	nonce, err := RandomString(16)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	details = &schemas.OAuthState{
+		Provider:    provider,
+		BindingHash: Hash(binding),
+		Nonce:       nonce,
+		ReturnTo:    returnTo,
+		LinkUserID:  linkUserID,
+	}
+
+	if pkce {
+		details.CodeVerifier, err = RandomString(32)
+		if err != nil {
+			return "", "", nil, err
+		}
+	}
+
+	val, err := json.Marshal(details)
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	ctx := context.TODO()
+	err = h.R.RS.SetNX(ctx, fmt.Sprintf("oauth_state:%s", state), string(val), oauthStateExpirationTime).Err()
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	return state, binding, details, nil
+}
+
+// Validate is a function that is used to validate the state that is returned by the provider against
+// the binding cookie of the browser, the state can only be used once
+func (State) Validate(h *initialize.H, state, binding, provider string) (*schemas.OAuthState, error) {
+	if state == "" || binding == "" {
+		return nil, errors.ErrInvalidState
+	}
+
+	ctx := context.TODO()
+	val := h.R.RS.GetDel(ctx, fmt.Sprintf("oauth_state:%s", state)).Val()
+	if val == "" {
+		return nil, errors.ErrInvalidState
+	}
+
+	var details schemas.OAuthState
+	if err := json.Unmarshal([]byte(val), &details); err != nil {
+		return nil, err
+	}
+
+	if details.Provider != provider {
+		return nil, errors.ErrInvalidState
+	}
+
+	if subtle.ConstantTimeCompare([]byte(details.BindingHash), []byte(Hash(binding))) != 1 {
+		return nil, errors.ErrInvalidState
+	}
+
+	return &details, nil
+}
+
+// CodeChallenge is a function that is used to derive the PKCE S256 code challenge from the verifier
+func (State) CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// IsReturnToAllowed is a function that is used to check wether the given URL that the user is sent
+// to after the login belongs to one of the allowed origins
+func (State) IsReturnToAllowed(returnTo string, allowlist []string) bool {
+	u, err := url.Parse(returnTo)
+	if err != nil || u.Host == "" || u.User != nil {
+		return false
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return false
+	}
+
+	origin := fmt.Sprintf("%s://%s", u.Scheme, u.Host)
+	for _, allowed := range allowlist {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,9 +2,13 @@ package utils
 
 import (
 	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"time"
 
 	"github.com/VinukaThejana/auth/backend/errors"
@@ -13,9 +17,20 @@ import (
 	"github.com/VinukaThejana/auth/backend/schemas"
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"gorm.io/gorm"
 )
 
+const (
+	// actionConfirmationExpirationTime is the time that a session is treated as recently authenticated
+	actionConfirmationExpirationTime = 5 * time.Minute
+	// SignupTicketExpirationTime is the time that the user has to choose a username to complete the signup
+	SignupTicketExpirationTime = 15 * time.Minute
+	// signupTicketType is the type and the audience of the signup tickets, the sessions are signed with the
+	// same key and reject the tokens with a type
+	signupTicketType = "signup"
+)
+
 // Token is a struct that gorups all the token related operations
 type Token struct{}
 
@@ -26,6 +41,11 @@ type TokenDetails struct {
 	TokenUUID string
 	UserID    string
 	ExpiresIn *int64
+	// AuthTime is the time that the user logged in (authenticated)
+	AuthTime int64
+	// ClientID (the audience) and Scope are only set on the tokens that are issued to OAuth clients
+	ClientID string
+	Scope    string
 }
 
 // CreateRefreshToken is a function that is used to create a refresh token
@@ -114,8 +134,9 @@ func (Token) CreateRefreshToken(h *initialize.H, userID, privateKey string, ttl
 	return td, nil
 }
 
-// CreateAccessToken is a function that is used to create a access token
-func (Token) CreateAccessToken(h *initialize.H, userID, privateKey string, ttl time.Duration) (*TokenDetails, error) {
+// CreateAccessToken is a function that is used to create a access token, the authTime is the time that
+// the user logged in (now when it is zero)
+func (Token) CreateAccessToken(h *initialize.H, userID, privateKey string, ttl time.Duration, authTime int64) (*TokenDetails, error) {
 	uid, err := uuid.NewUUID()
 	if err != nil {
 		return nil, err
@@ -130,6 +151,10 @@ func (Token) CreateAccessToken(h *initialize.H, userID, privateKey string, ttl t
 	*td.ExpiresIn = now.Add(ttl).Unix()
 	td.TokenUUID = uid.String()
 	td.UserID = userID
+	td.AuthTime = authTime
+	if td.AuthTime == 0 {
+		td.AuthTime = now.Unix()
+	}
 
 	decodePrivateKey, err := base64.StdEncoding.DecodeString(privateKey)
 	if err != nil {
@@ -147,6 +172,7 @@ func (Token) CreateAccessToken(h *initialize.H, userID, privateKey string, ttl t
 	claims["exp"] = td.ExpiresIn
 	claims["iat"] = now.Unix()
 	claims["nbf"] = now.Unix()
+	claims["auth_time"] = td.AuthTime
 
 	*td.Token, err = jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
 	if err != nil {
@@ -174,7 +200,8 @@ func (Token) ValidateRefreshToken(h *initialize.H, token, publicKey string) (*To
 		return nil, nil, errors.ErrInternalServerError
 	}
 
-	if refreshTokenDetails.UserID == td.UserID {
+	// INFO: The tokens of the OAuth clients must not be used as our own sessions
+	if refreshTokenDetails.UserID == td.UserID && refreshTokenDetails.ClientID == "" && td.ClientID == "" {
 		return td, &refreshTokenDetails, nil
 	}
 
@@ -190,13 +217,153 @@ func (Token) ValidateAccessToken(h *initialize.H, token, publicKey string) (*Tok
 		return nil, errors.ErrInternalServerError
 	}
 
-	if *val == *&td.UserID {
+	if *val == *&td.UserID && td.ClientID == "" {
 		return td, nil
 	}
 
 	return nil, errors.ErrUnauthorized
 }
 
+// CreateClientAccessToken is a function that is used to create an access token for the given OAuth client,
+// the client is the audience of the token
+func (Token) CreateClientAccessToken(h *initialize.H, userID, clientID, scope, privateKey string, ttl time.Duration) (*TokenDetails, error) {
+	now := time.Now().UTC()
+	td := &TokenDetails{
+		ExpiresIn: new(int64),
+		Token:     new(string),
+		TokenUUID: uuid.New().String(),
+		UserID:    userID,
+		ClientID:  clientID,
+		Scope:     scope,
+	}
+	*td.ExpiresIn = now.Add(ttl).Unix()
+
+	var err error
+	*td.Token, err = signToken(jwt.MapClaims{
+		"sub":        userID,
+		"aud":        clientID,
+		"scope":      scope,
+		"token_uuid": td.TokenUUID,
+		"exp":        td.ExpiresIn,
+		"iat":        now.Unix(),
+		"nbf":        now.Unix(),
+	}, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+	err = h.R.RS.Set(ctx, td.TokenUUID, userID, time.Unix(*td.ExpiresIn, 0).Sub(now)).Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
+// CreateClientRefreshToken is a function that is used to create a refresh token for the given OAuth client
+func (Token) CreateClientRefreshToken(h *initialize.H, userID, clientID, scope, accessTokenUUID, privateKey string, ttl time.Duration, authTime int64) (*TokenDetails, error) {
+	userUID, err := uuid.Parse(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	uid := uuid.New()
+	td := &TokenDetails{
+		ExpiresIn: new(int64),
+		Token:     new(string),
+		TokenUUID: uid.String(),
+		UserID:    userID,
+		ClientID:  clientID,
+		Scope:     scope,
+		AuthTime:  authTime,
+	}
+	*td.ExpiresIn = now.Add(ttl).Unix()
+
+	*td.Token, err = signToken(jwt.MapClaims{
+		"sub":        userID,
+		"aud":        clientID,
+		"scope":      scope,
+		"token_uuid": td.TokenUUID,
+		"exp":        td.ExpiresIn,
+		"iat":        now.Unix(),
+		"nbf":        now.Unix(),
+		"auth_time":  authTime,
+	}, privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	tokenVal, err := json.Marshal(schemas.RefreshTokenDetails{
+		UserID:          userID,
+		AccessTokenUUID: accessTokenUUID,
+		ClientID:        clientID,
+		Scope:           scope,
+		AuthTime:        authTime,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = h.DB.DB.Create(&models.Sessions{
+		TokenID:   uid,
+		UserID:    userUID,
+		ClientID:  clientID,
+		LoginAt:   now,
+		ExpiresAt: *td.ExpiresIn,
+	}).Error
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.TODO()
+	err = h.R.RS.Set(ctx, td.TokenUUID, string(tokenVal), time.Unix(*td.ExpiresIn, 0).Sub(now)).Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
+// ValidateClientAccessToken is a function that is used to validate an access token that was issued to an OAuth client
+func (Token) ValidateClientAccessToken(h *initialize.H, token, publicKey string) (*TokenDetails, error) {
+	td, val, err := validateToken(h, token, publicKey)
+	if err != nil {
+		return nil, err
+	} else if val == nil {
+		return nil, errors.ErrInternalServerError
+	}
+
+	if *val == td.UserID && td.ClientID != "" {
+		return td, nil
+	}
+
+	return nil, errors.ErrUnauthorized
+}
+
+// ValidateClientRefreshToken is a function that is used to validate a refresh token that was issued to the given OAuth client
+func (Token) ValidateClientRefreshToken(h *initialize.H, token, publicKey, clientID string) (*TokenDetails, *schemas.RefreshTokenDetails, error) {
+	td, val, err := validateToken(h, token, publicKey)
+	if err != nil {
+		return nil, nil, err
+	} else if val == nil {
+		return nil, nil, errors.ErrInternalServerError
+	}
+
+	var refreshTokenDetails schemas.RefreshTokenDetails
+	err = json.Unmarshal([]byte(*val), &refreshTokenDetails)
+	if err != nil {
+		return nil, nil, errors.ErrUnauthorized
+	}
+
+	if refreshTokenDetails.UserID == td.UserID && refreshTokenDetails.ClientID == clientID && td.ClientID == clientID {
+		return td, &refreshTokenDetails, nil
+	}
+
+	return nil, nil, errors.ErrUnauthorized
+}
+
 // DeleteToken is a function to delete a token
 func (Token) DeleteToken(h *initialize.H, refreshTokenUUID, accessTokenUUID string) error {
 	uid, err := uuid.Parse(refreshTokenUUID)
@@ -227,6 +394,168 @@ func (Token) DeleteToken(h *initialize.H, refreshTokenUUID, accessTokenUUID stri
 	return nil
 }
 
+// SetAccessToken is a function that is used to replace the access token of the session with the access
+// token that was issued with the refresh token, the previous access token is revoked so that revoking the
+// session revokes the only access token that is still valid
+func (Token) SetAccessToken(h *initialize.H, refreshTokenUUID, accessTokenUUID string) error {
+	ctx := context.TODO()
+
+	// INFO: The session is watched so that the access tokens of the concurrent refreshes are never lost
+	for i := 0; i < 3; i++ {
+		err := h.R.RS.Watch(ctx, func(tx *redis.Tx) error {
+			val, err := tx.Get(ctx, refreshTokenUUID).Result()
+			if err != nil {
+				if err == redis.Nil {
+					return errors.ErrUnauthorized
+				}
+
+				return err
+			}
+
+			var tokenValue schemas.RefreshTokenDetails
+			err = json.Unmarshal([]byte(val), &tokenValue)
+			if err != nil {
+				return err
+			}
+
+			previous := tokenValue.AccessTokenUUID
+			tokenValue.AccessTokenUUID = accessTokenUUID
+			updated, err := json.Marshal(tokenValue)
+			if err != nil {
+				return err
+			}
+
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.SetArgs(ctx, refreshTokenUUID, string(updated), redis.SetArgs{KeepTTL: true})
+				pipe.Del(ctx, previous)
+				return nil
+			})
+			return err
+		}, refreshTokenUUID)
+		if err != redis.TxFailedErr {
+			return err
+		}
+	}
+
+	return redis.TxFailedErr
+}
+
+// RotateToken is a function that is used to revoke the refresh token (and its access token) that is
+// exchanged for new tokens, the refresh token is claimed atomically so that only one of the concurrent
+// requests with the same refresh token gets the new tokens
+func (Token) RotateToken(h *initialize.H, refreshTokenUUID, accessTokenUUID string) error {
+	uid, err := uuid.Parse(refreshTokenUUID)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+	claimed, err := h.R.RS.Del(ctx, refreshTokenUUID).Result()
+	if err != nil {
+		return err
+	}
+	if claimed != 1 {
+		return errors.ErrUnauthorized
+	}
+
+	err = h.R.RS.Del(ctx, accessTokenUUID).Err()
+	if err != nil {
+		return err
+	}
+
+	return h.DB.DB.Delete(&models.Sessions{
+		TokenID: uid,
+	}).Error
+}
+
+// CreateIDToken is a function that is used to create an OpenID Connect ID token for the given OAuth client
+// with the given claims of the user
+func (Token) CreateIDToken(userClaims map[string]interface{}, issuer, clientID, nonce string, authTime int64, privateKey string, ttl time.Duration) (string, error) {
+	now := time.Now().UTC()
+
+	claims := jwt.MapClaims{}
+	for key, value := range userClaims {
+		claims[key] = value
+	}
+	claims["iss"] = issuer
+	claims["aud"] = clientID
+	claims["exp"] = now.Add(ttl).Unix()
+	claims["iat"] = now.Unix()
+	claims["auth_time"] = authTime
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	return signToken(claims, privateKey)
+}
+
+// JWKS is a function that is used to get the JSON Web Key Set that contains the given base64 encoded
+// public key, the OAuth clients use it to verify the ID tokens
+func (Token) JWKS(publicKey string) (map[string]interface{}, error) {
+	decodedPublicKey, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := jwt.ParseRSAPublicKeyFromPEM(decodedPublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := keyID(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"keys": []map[string]string{
+			{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": jwt.SigningMethodRS256.Alg(),
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			},
+		},
+	}, nil
+}
+
+// signToken is a function that is used to sign the given claims with the given base64 encoded private key,
+// the key ID is set so that the token can be verified with the JWKS
+func signToken(claims jwt.MapClaims, privateKey string) (string, error) {
+	decodePrivateKey, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(decodePrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	kid, err := keyID(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+
+	return token.SignedString(key)
+}
+
+// keyID is a function that is used to derive a stable key ID from the public key
+func keyID(key *rsa.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(der)
+	return base64.RawURLEncoding.EncodeToString(sum[:16]), nil
+}
+
 func validateToken(h *initialize.H, token, publicKey string) (*TokenDetails, *string, error) {
 	decodedPublicKey, err := base64.StdEncoding.DecodeString(publicKey)
 	if err != nil {
@@ -254,10 +583,24 @@ func validateToken(h *initialize.H, token, publicKey string) (*TokenDetails, *st
 		return nil, nil, fmt.Errorf("Validate : invalid token")
 	}
 
+	// INFO: The other tokens that are signed with the same key (signup tickets) have a type
+	if _, ok := claims["typ"]; ok {
+		return nil, nil, fmt.Errorf("Validate : invalid token")
+	}
+
 	td := &TokenDetails{
 		TokenUUID: fmt.Sprint(claims["token_uuid"]),
 		UserID:    fmt.Sprint(claims["sub"]),
 	}
+	if aud, err := claims.GetAudience(); err == nil && len(aud) > 0 {
+		td.ClientID = aud[0]
+	}
+	td.Scope, _ = claims["scope"].(string)
+	if authTime, ok := claims["auth_time"].(float64); ok {
+		td.AuthTime = int64(authTime)
+	} else if issuedAt, err := claims.GetIssuedAt(); err == nil && issuedAt != nil {
+		td.AuthTime = issuedAt.Unix()
+	}
 
 	ctx := context.TODO()
 	val := h.R.RS.Get(ctx, td.TokenUUID).Val()
@@ -268,6 +611,50 @@ func validateToken(h *initialize.H, token, publicKey string) (*TokenDetails, *st
 	return td, &val, nil
 }
 
+// DeleteUserTokens is a function that is used to revoke all the sessions of the given user
+func (Token) DeleteUserTokens(h *initialize.H, userID string) error {
+	return deleteSessions(h, h.DB.DB.Where("user_id = ?", userID))
+}
+
+// DeleteClientTokens is a function that is used to revoke the tokens that were issued to the given OAuth
+// client, only the tokens of the given user are revoked when the userID is not empty
+func (Token) DeleteClientTokens(h *initialize.H, clientID, userID string) error {
+	query := h.DB.DB.Where("client_id = ?", clientID)
+	if userID != "" {
+		query = query.Where("user_id = ?", userID)
+	}
+
+	return deleteSessions(h, query)
+}
+
+// deleteSessions is a function that is used to revoke the sessions that match the given query along
+// with the access tokens that were issued with them
+func deleteSessions(h *initialize.H, query *gorm.DB) error {
+	var sessions []models.Sessions
+	err := query.Find(&sessions).Error
+	if err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+	for _, session := range sessions {
+		val := h.R.RS.Get(ctx, session.TokenID.String()).Val()
+
+		var tokenValue schemas.RefreshTokenDetails
+		if val != "" && json.Unmarshal([]byte(val), &tokenValue) == nil {
+			h.R.RS.Del(ctx, tokenValue.AccessTokenUUID)
+		}
+		h.R.RS.Del(ctx, session.TokenID.String())
+
+		err = h.DB.DB.Delete(&models.Sessions{}, "token_id = ?", session.TokenID).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // DeleteExpiredTokens is a function that is used to delete expired session tokens
 func (Token) DeleteExpiredTokens(h *initialize.H, userID string) {
 	var sessions []models.Sessions
@@ -286,3 +673,113 @@ func (Token) DeleteExpiredTokens(h *initialize.H, userID string) {
 		return
 	}
 }
+
+// SetActionConfirmed is a function that is used to mark the session of the given access token as
+// recently authenticated, sensitive actions are only allowed on such sessions
+func (Token) SetActionConfirmed(h *initialize.H, accessTokenUUID string) error {
+	ctx := context.TODO()
+	return h.R.RS.Set(ctx, fmt.Sprintf("confirmed:%s", accessTokenUUID), "true", actionConfirmationExpirationTime).Err()
+}
+
+// IsActionConfirmed is a function that is used to check wether the session of the given access token
+// was recently authenticated
+func (Token) IsActionConfirmed(h *initialize.H, accessTokenUUID string) bool {
+	ctx := context.TODO()
+	return h.R.RS.Get(ctx, fmt.Sprintf("confirmed:%s", accessTokenUUID)).Val() == "true"
+}
+
+// CreateSignupTicket is a function that is used to store the provider account of a user that has to choose
+// a username and to create a short lived signed ticket that refers to it
+func (Token) CreateSignupTicket(h *initialize.H, details schemas.SignupTicket, privateKey string) (string, error) {
+	ticketID := uuid.New().String()
+
+	val, err := json.Marshal(details)
+	if err != nil {
+		return "", err
+	}
+
+	decodePrivateKey, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := jwt.ParseRSAPrivateKeyFromPEM(decodePrivateKey)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	claims := make(jwt.MapClaims)
+	claims["sub"] = ticketID
+	claims["typ"] = signupTicketType
+	claims["aud"] = signupTicketType
+	claims["exp"] = now.Add(SignupTicketExpirationTime).Unix()
+	claims["iat"] = now.Unix()
+	claims["nbf"] = now.Unix()
+
+	ticket, err := jwt.NewWithClaims(jwt.SigningMethodRS256, claims).SignedString(key)
+	if err != nil {
+		return "", err
+	}
+
+	ctx := context.TODO()
+	err = h.R.RS.Set(ctx, fmt.Sprintf("signup:%s", ticketID), string(val), SignupTicketExpirationTime).Err()
+	if err != nil {
+		return "", err
+	}
+
+	return ticket, nil
+}
+
+// ValidateSignupTicket is a function that is used to validate the signature of the signup ticket and to get
+// the ID of the ticket, the ticket is consumed with ConsumeSignupTicket
+func (Token) ValidateSignupTicket(h *initialize.H, ticket, publicKey string) (ticketID string, err error) {
+	decodedPublicKey, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := jwt.ParseRSAPublicKeyFromPEM(decodedPublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(ticket, claims, func(t *jwt.Token) (interface{}, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg()}), jwt.WithAudience(signupTicketType))
+	if err != nil {
+		return "", errors.ErrSignupTicketExpired
+	}
+
+	if claims["typ"] != signupTicketType {
+		return "", errors.ErrSignupTicketExpired
+	}
+
+	ticketID = fmt.Sprint(claims["sub"])
+
+	ctx := context.TODO()
+	if h.R.RS.Exists(ctx, fmt.Sprintf("signup:%s", ticketID)).Val() != 1 {
+		return "", errors.ErrSignupTicketExpired
+	}
+
+	return ticketID, nil
+}
+
+// ConsumeSignupTicket is a function that is used to get the provider account that the signup ticket refers
+// to, the ticket can only be used once
+func (Token) ConsumeSignupTicket(h *initialize.H, ticketID string) (*schemas.SignupTicket, error) {
+	ctx := context.TODO()
+	val := h.R.RS.GetDel(ctx, fmt.Sprintf("signup:%s", ticketID)).Val()
+	if val == "" {
+		return nil, errors.ErrSignupTicketExpired
+	}
+
+	details := &schemas.SignupTicket{}
+	err := json.Unmarshal([]byte(val), details)
+	if err != nil {
+		return nil, err
+	}
+
+	return details, nil
+}
@@ -1,6 +1,82 @@
 // Package utils used to initialize various utility packages
 package utils
 
-import "github.com/VinukaThejana/go-utils/logger"
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/VinukaThejana/go-utils/logger"
+	"github.com/redis/go-redis/v9"
+)
 
 var log logger.Logger
+
+// RandomString is a function that is used to generate a URL safe random string from the given
+// number of random bytes
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// rateLimitScript counts the request and starts the window with the first request of it, the counter can
+// never be left without an expiry, it returns the number of the requests in the window
+var rateLimitScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 or redis.call("PTTL", KEYS[1]) < 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+// RateLimit is a function that is used to count the request against the limit of the given key in a fixed
+// window, false is returned when the limit is reached
+func RateLimit(ctx context.Context, client *redis.Client, key string, limit int64, window time.Duration) (bool, error) {
+	count, err := rateLimitScript.Run(ctx, client, []string{key}, window.Milliseconds()).Int64()
+	if err != nil {
+		return false, err
+	}
+
+	return count <= limit, nil
+}
+
+// WithQuery is a function that is used to add the given query parameters to the URL while keeping the
+// query parameters that it already has
+func WithQuery(rawURL string, params url.Values) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String()
+}
+
+// Contains is a function that is used to check wether the given value is one of the values
+func Contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Hash is a function that is used to get the hex encoded SHA256 hash of the given value
+func Hash(value string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(value)))
+}